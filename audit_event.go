@@ -25,6 +25,20 @@ type DotCased struct {
 	ProcessedAt        *time.Time                   `json:"processed_at,omitempty"`
 	ReceivedAt         *time.Time                   `json:"received_at,omitempty"`
 	PublishedAt        time.Time                    `json:"published_at"`
+
+	// Sequence and PreviousHash link the audit event to the previous audit
+	// event published by the process, see HashChain.
+	Sequence     uint64 `json:"sequence,omitempty"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+
+	// Signature is the Ed25519 signature of the audit event made with the key
+	// identified by KeyID, see KeySet.
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+
+	// SchemaViolations are the ways the audit event does not match its
+	// schema, see SchemaValidator.
+	SchemaViolations []SchemaViolation `json:"schema_violations,omitempty"`
 }
 
 // AuditEvent ...
@@ -40,17 +54,30 @@ func (ae AuditEvent) MarshalJSON() ([]byte, error) {
 }
 
 // NewAuditEventPayload ...
+//
+// Each payload is assigned a unique ID that is sent with every attempt to
+// publish it, allowing Cased to deduplicate audit events that are published
+// more than once.
+//
+// The payload holds a snapshot of the audit event, so changes made to the
+// audit event afterwards are not published.
 func NewAuditEventPayload(event AuditEvent) *AuditEventPayload {
-	aep := &AuditEventPayload{
+	aep := newAuditEventPayload(event)
+	aep.process()
+
+	return aep
+}
+
+// newAuditEventPayload returns the payload of the audit event before it is
+// processed.
+func newAuditEventPayload(event AuditEvent) *AuditEventPayload {
+	return &AuditEventPayload{
 		DotCased: DotCased{
 			PII: map[string][]*SensitiveRange{},
+			ID:  NewEventID(),
 		},
-		AuditEvent: event,
+		AuditEvent: event.Snapshot(),
 	}
-
-	aep.process()
-
-	return aep
 }
 
 // AuditEventPayload is the wrapper struct hosting the nestable JSON AuditEvent
@@ -0,0 +1,239 @@
+package cased
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Labels of sensitive values added by AuditEventBuilder.
+const (
+	EmailSensitiveLabel     = "email"
+	IPAddressSensitiveLabel = "ip-address"
+)
+
+// Standard audit event fields set by AuditEventBuilder.
+const (
+	ActionField    = "action"
+	ActorField     = "actor"
+	ActorIDField   = "actor_id"
+	LocationField  = "location"
+	TimestampField = "timestamp"
+)
+
+// MissingFieldError is returned when an audit event is built without a
+// required field.
+type MissingFieldError struct {
+	Field string
+}
+
+func (e *MissingFieldError) Error() string {
+	return fmt.Sprintf("cased: audit event is missing required field %q", e.Field)
+}
+
+// ReservedFieldError is returned when a field set on an audit event builder
+// conflicts with a standard field or one that was already set.
+type ReservedFieldError struct {
+	Field string
+}
+
+func (e *ReservedFieldError) Error() string {
+	return fmt.Sprintf("cased: audit event field %q is reserved or already set", e.Field)
+}
+
+// AuditEventBuilder builds audit events with the standard Cased fields so they
+// are named consistently across an application:
+//
+//	err := cased.NewAuditEventBuilder("repository.create").
+//		Actor("jane@example.com", "User;1").
+//		Target("repository", "cased/cased-go", "Repository;1").
+//		Location(req.RemoteAddr).
+//		Metadata("request_id", requestID).
+//		PublishWithContext(ctx)
+//
+// Values that look like email or IP addresses are marked as sensitive
+// automatically.
+type AuditEventBuilder struct {
+	event AuditEvent
+	err   error
+}
+
+// NewAuditEventBuilder returns a builder for an audit event with the action.
+func NewAuditEventBuilder(action string) *AuditEventBuilder {
+	b := &AuditEventBuilder{event: AuditEvent{}}
+	if action != "" {
+		b.event[ActionField] = action
+	}
+
+	return b
+}
+
+// Actor sets who performed the action, such as a username or email address,
+// and their ID. The ID is omitted if empty.
+func (b *AuditEventBuilder) Actor(actor, id string) *AuditEventBuilder {
+	if actor != "" {
+		b.set(ActorField, sensitive(actor))
+	}
+	if id != "" {
+		b.set(ActorIDField, id)
+	}
+
+	return b
+}
+
+// Target sets what the action was performed on, such as a repository, as the
+// kind field with the target's name and the kind_id field with its ID. The ID
+// is omitted if empty. Audit events can have more than one target of different
+// kinds.
+func (b *AuditEventBuilder) Target(kind, name, id string) *AuditEventBuilder {
+	if kind == "" {
+		return b.fail(&MissingFieldError{Field: "target kind"})
+	}
+
+	if b.reserved(kind) {
+		return b.fail(&ReservedFieldError{Field: kind})
+	}
+
+	if id != "" && b.reserved(kind+"_id") {
+		return b.fail(&ReservedFieldError{Field: kind + "_id"})
+	}
+
+	b.set(kind, sensitive(name))
+	if id != "" {
+		b.set(kind+"_id", id)
+	}
+
+	return b
+}
+
+// Location sets where the action was performed from, such as an IP address.
+func (b *AuditEventBuilder) Location(location string) *AuditEventBuilder {
+	return b.set(LocationField, sensitive(location))
+}
+
+// Metadata sets any other field of the audit event. String values that look
+// like email or IP addresses are marked as sensitive.
+func (b *AuditEventBuilder) Metadata(key string, value interface{}) *AuditEventBuilder {
+	if b.reserved(key) {
+		return b.fail(&ReservedFieldError{Field: key})
+	}
+
+	if s, ok := value.(string); ok {
+		value = sensitive(s)
+	}
+
+	return b.set(key, value)
+}
+
+// Sensitive sets a field of the audit event marked as sensitive with the
+// label.
+func (b *AuditEventBuilder) Sensitive(key, value, label string) *AuditEventBuilder {
+	if b.reserved(key) {
+		return b.fail(&ReservedFieldError{Field: key})
+	}
+
+	return b.set(key, NewSensitiveValue(value, label))
+}
+
+// Timestamp sets when the action was performed, if it was not just now.
+func (b *AuditEventBuilder) Timestamp(timestamp time.Time) *AuditEventBuilder {
+	return b.set(TimestampField, timestamp.UTC())
+}
+
+// Build returns the audit event, or the first error encountered while building
+// it. An audit event requires an action and an actor.
+func (b *AuditEventBuilder) Build() (AuditEvent, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	for _, field := range []string{ActionField, ActorField} {
+		if _, ok := b.event[field]; !ok {
+			return nil, &MissingFieldError{Field: field}
+		}
+	}
+
+	return b.event.Snapshot(), nil
+}
+
+// Publish builds and publishes the audit event with the current publisher.
+func (b *AuditEventBuilder) Publish() error {
+	return b.PublishWithContext(context.Background())
+}
+
+// PublishWithContext builds and publishes the audit event with the current
+// publisher, enriched with the context set in the request, see
+// PublishWithContext.
+func (b *AuditEventBuilder) PublishWithContext(ctx context.Context) error {
+	event, err := b.Build()
+	if err != nil {
+		return err
+	}
+
+	return PublishWithContext(ctx, event)
+}
+
+func (b *AuditEventBuilder) set(key string, value interface{}) *AuditEventBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	if key == DotCasedKey {
+		return b.fail(&ReservedFieldError{Field: key})
+	}
+
+	b.event[key] = value
+	return b
+}
+
+func (b *AuditEventBuilder) fail(err error) *AuditEventBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+
+	return b
+}
+
+// reserved reports whether the key is a standard field or was already set.
+func (b *AuditEventBuilder) reserved(key string) bool {
+	switch key {
+	case ActionField, ActorField, ActorIDField, LocationField, TimestampField, DotCasedKey:
+		return true
+	}
+
+	_, ok := b.event[key]
+	return ok
+}
+
+// sensitive returns the value marked as sensitive if it looks like an email
+// or IP address.
+func sensitive(value string) interface{} {
+	switch {
+	case isIPAddress(value):
+		return NewSensitiveValue(value, IPAddressSensitiveLabel)
+	case isEmailAddress(value):
+		return NewSensitiveValue(value, EmailSensitiveLabel)
+	default:
+		return value
+	}
+}
+
+func isIPAddress(value string) bool {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	return net.ParseIP(value) != nil
+}
+
+func isEmailAddress(value string) bool {
+	if !strings.Contains(value, "@") || strings.ContainsAny(value, " <>") {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
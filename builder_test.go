@@ -0,0 +1,112 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditEventBuilder(t *testing.T) {
+	timestamp := time.Date(2021, 1, 2, 15, 4, 5, 0, time.FixedZone("PST", -8*60*60))
+
+	event, err := NewAuditEventBuilder("repository.create").
+		Actor("jane@example.com", "User;1").
+		Target("repository", "cased/cased-go", "Repository;1").
+		Target("organization", "cased", "").
+		Location("1.1.1.1").
+		Metadata("request_id", "req_1").
+		Metadata("invitee", "john@example.com").
+		Metadata("count", 3).
+		Sensitive("phone", "555-555-5555", "phone-number").
+		Timestamp(timestamp).
+		Build()
+
+	assert.NoError(t, err)
+	assert.Equal(t, AuditEvent{
+		"action":        "repository.create",
+		"actor":         NewSensitiveValue("jane@example.com", EmailSensitiveLabel),
+		"actor_id":      "User;1",
+		"repository":    "cased/cased-go",
+		"repository_id": "Repository;1",
+		"organization":  "cased",
+		"location":      NewSensitiveValue("1.1.1.1", IPAddressSensitiveLabel),
+		"request_id":    "req_1",
+		"invitee":       NewSensitiveValue("john@example.com", EmailSensitiveLabel),
+		"count":         3,
+		"phone":         NewSensitiveValue("555-555-5555", "phone-number"),
+		"timestamp":     timestamp.UTC(),
+	}, event)
+}
+
+func TestAuditEventBuilderRequiresActionAndActor(t *testing.T) {
+	_, err := NewAuditEventBuilder("").Actor("jane", "").Build()
+
+	var mfe *MissingFieldError
+	if assert.True(t, errors.As(err, &mfe)) {
+		assert.Equal(t, ActionField, mfe.Field)
+	}
+
+	_, err = NewAuditEventBuilder("user.login").Actor("", "User;1").Build()
+	if assert.True(t, errors.As(err, &mfe)) {
+		assert.Equal(t, ActorField, mfe.Field)
+	}
+}
+
+func TestAuditEventBuilderRejectsReservedFields(t *testing.T) {
+	for _, build := range []func(*AuditEventBuilder) *AuditEventBuilder{
+		func(b *AuditEventBuilder) *AuditEventBuilder { return b.Metadata("action", "user.logout") },
+		func(b *AuditEventBuilder) *AuditEventBuilder { return b.Metadata(DotCasedKey, "") },
+		func(b *AuditEventBuilder) *AuditEventBuilder { return b.Target("actor", "jane", "") },
+		func(b *AuditEventBuilder) *AuditEventBuilder {
+			return b.Metadata("repository_id", "1").Target("repository", "cased", "Repository;1")
+		},
+		func(b *AuditEventBuilder) *AuditEventBuilder {
+			return b.Metadata("team", "a").Sensitive("team", "b", "name")
+		},
+	} {
+		_, err := build(NewAuditEventBuilder("user.login").Actor("jane", "")).Build()
+
+		var rfe *ReservedFieldError
+		assert.True(t, errors.As(err, &rfe), err)
+	}
+}
+
+func TestAuditEventBuilderDetectsSensitiveValues(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"jane@example.com", NewSensitiveValue("jane@example.com", EmailSensitiveLabel)},
+		{"2001:db8::1", NewSensitiveValue("2001:db8::1", IPAddressSensitiveLabel)},
+		{"10.0.0.1:443", NewSensitiveValue("10.0.0.1:443", IPAddressSensitiveLabel)},
+		{"Jane <jane@example.com>", "Jane <jane@example.com>"},
+		{"@jane", "@jane"},
+		{"San Francisco", "San Francisco"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, sensitive(test.value), test.value)
+	}
+}
+
+func TestAuditEventBuilderPublishWithContext(t *testing.T) {
+	mp, restore := NewMockPublisher()
+	defer restore()
+
+	ctx := context.WithValue(context.Background(), ContextKey, AuditEvent{"request_id": "req_1"})
+	err := NewAuditEventBuilder("user.login").Actor("jane", "User;1").PublishWithContext(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []AuditEvent{{
+		"action":     "user.login",
+		"actor":      "jane",
+		"actor_id":   "User;1",
+		"request_id": "req_1",
+	}}, mp.Events)
+
+	assert.Error(t, NewAuditEventBuilder("user.login").Publish())
+	assert.Len(t, mp.Events, 1)
+}
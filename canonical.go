@@ -0,0 +1,117 @@
+package cased
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// CanonicalJSON returns the canonical encoding of the JSON data: object keys
+// are sorted, insignificant whitespace is removed, strings are encoded without
+// escaping HTML characters, and numbers are kept exactly as they appear.
+//
+// Audit events are hashed and signed in their canonical encoding so they can
+// be verified after being decoded and encoded again, such as when read back
+// from a JSON Lines export.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// canonicalPayload returns the canonical encoding of the encoded audit event
+// payload without the .cased fields, which is what audit events are hashed and
+// signed as. Audit events are hashed without their signature and key ID, as
+// they are signed once hashed, and signed without their signature.
+func canonicalPayload(data []byte, without ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v map[string]interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if dc, ok := v[DotCasedKey].(map[string]interface{}); ok {
+		for _, field := range without {
+			delete(dc, field)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		buf.WriteString(v.String())
+	case string:
+		return writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		buf.WriteByte('{')
+		for i, key := range sortedKeys(v) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("cased: cannot canonicalize %T", v)
+	}
+
+	return nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+
+	// Encode terminates each value with a newline.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
@@ -37,6 +37,15 @@ var (
 
 	// WorkflowsKey is the workflows API key for managing and triggering workflows.
 	WorkflowsKey = os.Getenv("CASED_WORKFLOWS_KEY")
+
+	// Compression is the encoding of the codec request bodies sent to Cased are
+	// compressed with, such as gzip. Request bodies are not compressed if empty.
+	Compression = os.Getenv("CASED_COMPRESSION")
+
+	// CompressionThreshold is the size in bytes a request body must reach
+	// before it is compressed (default: 1024). Request bodies of any size are
+	// compressed if 0.
+	CompressionThreshold = envCompressionThreshold()
 )
 
 var endpoints Endpoints
@@ -118,6 +127,14 @@ func GetEndpointWithConfig(endpointType AvailableEndpoint, config *EndpointConfi
 		config.HTTPClient = httpClient
 	}
 
+	if config.Compression == nil {
+		config.Compression = String(Compression)
+	}
+
+	if config.CompressionThreshold == nil {
+		config.CompressionThreshold = Int(CompressionThreshold)
+	}
+
 	switch endpointType {
 	case APIEndpoint:
 		if config.URL == nil {
@@ -176,14 +193,31 @@ type EndpointConfig struct {
 	HTTPClient *http.Client
 	APIKey     *string
 	URL        *string
+
+	// Compression is the encoding of the codec request bodies are compressed
+	// with, such as gzip. Defaults to the CASED_COMPRESSION environment
+	// variable.
+	Compression *string
+
+	// CompressionThreshold is the size in bytes a request body must reach
+	// before it is compressed. Request bodies of any size are compressed if 0.
+	// Defaults to the CASED_COMPRESSION_THRESHOLD environment variable.
+	CompressionThreshold *int
+
+	// RateLimiter, if set, limits the requests made to the endpoint. A
+	// RateLimiter can be shared with other endpoints and publishers.
+	RateLimiter *RateLimiter
 }
 
 func newEndpointImplementation(endpointType AvailableEndpoint, config *EndpointConfig) Endpoint {
 	return &EndpointImplementation{
-		HTTPClient: config.HTTPClient,
-		Endpoint:   endpointType,
-		URL:        *config.URL,
-		APIKey:     *config.APIKey,
+		HTTPClient:           config.HTTPClient,
+		Endpoint:             endpointType,
+		URL:                  *config.URL,
+		APIKey:               *config.APIKey,
+		Codec:                codec(*config.Compression),
+		CompressionThreshold: *config.CompressionThreshold,
+		RateLimiter:          config.RateLimiter,
 	}
 }
 
@@ -192,6 +226,15 @@ type EndpointImplementation struct {
 	HTTPClient *http.Client
 	URL        string
 	APIKey     string
+
+	// Codec compresses request bodies once they reach CompressionThreshold.
+	// Request bodies are not compressed if nil.
+	Codec                Codec
+	CompressionThreshold int
+
+	// RateLimiter limits the requests made to the endpoint. Requests are not
+	// limited if nil.
+	RateLimiter *RateLimiter
 }
 
 func (ei *EndpointImplementation) Call(method, path string, params ParamsContainer, i interface{}) error {
@@ -200,6 +243,11 @@ func (ei *EndpointImplementation) Call(method, path string, params ParamsContain
 		return err
 	}
 
+	data, encoding, err := compress(ei.Codec, ei.CompressionThreshold, data)
+	if err != nil {
+		return err
+	}
+
 	url := ei.URL + path
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
 	if err != nil {
@@ -210,12 +258,20 @@ func (ei *EndpointImplementation) Call(method, path string, params ParamsContain
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ei.APIKey))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	if err := ei.RateLimiter.Wait(req.Context()); err != nil {
+		return err
+	}
 
 	resp, err := ei.HTTPClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	ei.RateLimiter.Observe(resp)
 
 	// After a resource is successfully deleted an error or decoding of the
 	// response is not necessary
@@ -266,38 +322,65 @@ func Int(i int) *int {
 // events to Cased.
 type Publisher interface {
 	Publish(event AuditEvent) error
+	PublishContext(ctx context.Context, event AuditEvent) error
 	Options() PublisherOptions
 	Flush(timeout time.Duration) bool
+	FlushContext(ctx context.Context) bool
+	Close(ctx context.Context) error
 }
 
 // Publish publishes an audit event to Cased.
 func Publish(event AuditEvent) error {
+	return publish(context.Background(), event)
+}
+
+func publish(ctx context.Context, event AuditEvent) error {
 	client := CurrentPublisher()
 	if client.Options().Silence {
 		Logger.Println("Audit event was silenced.")
 		return nil
 	}
 
-	return client.Publish(event)
+	return client.PublishContext(ctx, event)
 }
 
 // PublishWithContext enriches the provided audit event with the context set in
 // the request. If the same key is present in both the context and provided
 // audit event, the audit event value will be preserved.
+//
+// The context's cancellation and deadline are respected while publishing the
+// audit event.
 func PublishWithContext(ctx context.Context, event AuditEvent) error {
 	c := GetContextFromContext(ctx)
-	for key, value := range c {
-		if _, ok := event[key]; ok {
-			continue
-		}
+	if len(c) == 0 {
+		return publish(ctx, event)
+	}
 
-		event[key] = value
+	// Merge into a new audit event so the caller's audit event is not changed.
+	merged := make(AuditEvent, len(c)+len(event))
+	for key, value := range c {
+		merged[key] = value
+	}
+	for key, value := range event {
+		merged[key] = value
 	}
 
-	return Publish(event)
+	return publish(ctx, merged)
 }
 
 // Flush waits for audit events to be published.
 func Flush(timeout time.Duration) bool {
 	return CurrentPublisher().Flush(timeout)
 }
+
+// FlushContext waits for audit events to be published or until the context is
+// done.
+func FlushContext(ctx context.Context) bool {
+	return CurrentPublisher().FlushContext(ctx)
+}
+
+// Close stops the current publisher from accepting audit events and waits for
+// queued audit events to be published until the context is done.
+func Close(ctx context.Context) error {
+	return CurrentPublisher().Close(ctx)
+}
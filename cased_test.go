@@ -69,3 +69,18 @@ func TestCasedPublishWithContextUsesPublishedAuditEvent(t *testing.T) {
 	assert.Equal(t, 1, len(mp.Events))
 	assert.Equal(t, expected, mp.Events[0])
 }
+
+func TestCasedPublishWithContextRespectsCancellation(t *testing.T) {
+	mp, restore := NewMockPublisher()
+	defer restore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := PublishWithContext(ctx, AuditEvent{
+		"action": "user.login",
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(mp.Events))
+}
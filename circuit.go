@@ -0,0 +1,210 @@
+package cased
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultCircuitBreakerCoolDown = 30 * time.Second
+
+// ErrCircuitOpen is returned when a request to publish audit events is not
+// made because the circuit breaker is open.
+var ErrCircuitOpen = errors.New("cased: circuit breaker is open")
+
+// CircuitOpenError is returned when a request to publish audit events failed
+// and opened the circuit breaker. It matches ErrCircuitOpen with errors.Is so
+// the audit events are handled like those published while the circuit breaker
+// is open, and unwraps to the error of the failed request.
+type CircuitOpenError struct {
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "cased: circuit breaker opened: " + e.Err.Error()
+}
+
+// Is reports whether the target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Unwrap returns the error of the failed request.
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitState is the state of the circuit breaker around requests to publish
+// audit events.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen fails all requests immediately until the cool-down has
+	// passed.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a single trial request through to determine whether
+	// Cased is available again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops requests from being made once a number of consecutive
+// requests failed, so audit events do not wait for requests that are likely to
+// time out while Cased is unavailable.
+type circuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	metrics   Metrics
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker returns the circuit breaker configured by the options, nil
+// if the circuit breaker is disabled.
+func newCircuitBreaker(options PublisherOptions, metrics Metrics) *circuitBreaker {
+	if options.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+
+	b := &circuitBreaker{
+		threshold: options.CircuitBreakerThreshold,
+		coolDown:  options.CircuitBreakerCoolDown,
+		metrics:   metrics,
+		now:       time.Now,
+	}
+
+	if b.coolDown <= 0 {
+		b.coolDown = defaultCircuitBreakerCoolDown
+	}
+
+	return b
+}
+
+// allow returns ErrCircuitOpen if the request should not be made. Once the
+// cool-down has passed a single trial request is allowed.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return ErrCircuitOpen
+		}
+		b.transition(CircuitHalfOpen)
+		b.probing = true
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// record records the outcome of an allowed request and reports whether it
+// opened the circuit breaker. Only errors that indicate Cased is unavailable
+// count as failures.
+func (b *circuitBreaker) record(err error) bool {
+	if b == nil {
+		return false
+	}
+
+	failed := retryable(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return true
+		}
+
+		b.failures = 0
+		b.transition(CircuitClosed)
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return false
+		}
+
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+			return true
+		}
+	}
+
+	return false
+}
+
+// release releases an allowed request that was abandoned before its outcome
+// was known, such as when its context was canceled.
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+	}
+}
+
+// State returns the current state of the circuit breaker.
+func (b *circuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *circuitBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(CircuitOpen)
+}
+
+func (b *circuitBreaker) transition(state CircuitState) {
+	if b.state == state {
+		return
+	}
+
+	Logger.Printf("Circuit breaker changed from %s to %s.", b.state, state)
+	b.state = state
+	b.metrics.ObserveCircuitState(state)
+}
@@ -0,0 +1,266 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCircuitBreaker(threshold int, coolDown time.Duration) (*circuitBreaker, *MemoryMetrics, *time.Time) {
+	m := NewMemoryMetrics()
+	now := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+	b := newCircuitBreaker(PublisherOptions{
+		CircuitBreakerThreshold: threshold,
+		CircuitBreakerCoolDown:  coolDown,
+	}, m)
+	b.now = func() time.Time { return now }
+
+	return b, m, &now
+}
+
+var errUnavailable = &PublishError{StatusCode: http.StatusServiceUnavailable}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(PublisherOptions{}, noopMetrics{})
+
+	assert.Nil(t, b)
+	b.record(errUnavailable)
+	assert.NoError(t, b.allow())
+	assert.Equal(t, CircuitClosed, b.State())
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, m, _ := newTestCircuitBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.allow())
+		b.record(errUnavailable)
+	}
+	assert.NoError(t, b.allow())
+	b.record(nil)
+	assert.Equal(t, CircuitClosed, b.State())
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.allow())
+		assert.Equal(t, i == 2, b.record(errUnavailable))
+	}
+
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+	assert.Equal(t, uint64(1), m.Snapshot().CircuitOpened)
+	assert.Equal(t, CircuitOpen, m.Snapshot().CircuitState)
+}
+
+func TestCircuitBreakerRecordReportsOnlyTheRequestOpeningIt(t *testing.T) {
+	b, _, _ := newTestCircuitBreaker(1, time.Minute)
+
+	// Both requests were allowed before the first one failed.
+	assert.NoError(t, b.allow())
+	assert.NoError(t, b.allow())
+	assert.True(t, b.record(errUnavailable))
+
+	assert.False(t, b.record(errUnavailable))
+	assert.False(t, b.record(&PublishError{StatusCode: http.StatusBadRequest}))
+	assert.Equal(t, CircuitOpen, b.State())
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	b, _, _ := newTestCircuitBreaker(1, time.Minute)
+
+	assert.NoError(t, b.allow())
+	b.record(&PublishError{StatusCode: http.StatusUnauthorized})
+
+	assert.Equal(t, CircuitClosed, b.State())
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	b, m, now := newTestCircuitBreaker(1, time.Minute)
+
+	assert.NoError(t, b.allow())
+	b.record(errUnavailable)
+	assert.Equal(t, CircuitOpen, b.State())
+
+	*now = now.Add(59 * time.Second)
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+
+	*now = now.Add(time.Second)
+	assert.NoError(t, b.allow())
+	assert.Equal(t, CircuitHalfOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+
+	// A failed probe opens the circuit for another cool-down.
+	b.record(errUnavailable)
+	assert.Equal(t, CircuitOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.allow())
+
+	*now = now.Add(time.Minute)
+	assert.NoError(t, b.allow())
+	b.record(nil)
+
+	assert.Equal(t, CircuitClosed, b.State())
+	assert.NoError(t, b.allow())
+	assert.Equal(t, uint64(2), m.Snapshot().CircuitOpened)
+	assert.Equal(t, CircuitClosed, m.Snapshot().CircuitState)
+}
+
+func TestCircuitBreakerReleasesAbandonedProbe(t *testing.T) {
+	b, _, now := newTestCircuitBreaker(1, time.Minute)
+
+	assert.NoError(t, b.allow())
+	b.record(errUnavailable)
+
+	*now = now.Add(time.Minute)
+	assert.NoError(t, b.allow())
+	b.release()
+
+	assert.Equal(t, CircuitHalfOpen, b.State())
+	assert.NoError(t, b.allow())
+}
+
+func TestHTTPSyncTransportFailsFastWhenCircuitOpen(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 10
+	ps.failStatus = http.StatusServiceUnavailable
+
+	var failed []DeliveryReport
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+		WithCircuitBreaker(2, time.Minute),
+		WithOnFailed(func(dr DeliveryReport) {
+			failed = append(failed, dr)
+		}),
+	)
+	defer restore()
+
+	var pe *PublishError
+	assert.True(t, errors.As(p.Publish(AuditEvent{"action": "user.login"}), &pe))
+	assert.Equal(t, ErrCircuitOpen, p.Publish(AuditEvent{"action": "user.logout"}))
+
+	requests, _ := ps.counts()
+	assert.Equal(t, 2, requests)
+	if assert.Len(t, failed, 2) {
+		assert.Equal(t, 2, failed[0].Attempts)
+		assert.Equal(t, ErrCircuitOpen, failed[1].Err)
+		assert.Equal(t, 0, failed[1].Attempts)
+	}
+}
+
+func TestHTTPSyncTransportPublishesToFallbackWhenCircuitOpen(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 10
+	ps.failStatus = http.StatusBadGateway
+
+	fallback := &recordingTransport{}
+	var delivered []DeliveryReport
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		WithCircuitBreaker(1, time.Minute),
+		WithFallbackTransport(fallback),
+		WithOnDelivered(func(dr DeliveryReport) {
+			delivered = append(delivered, dr)
+		}),
+	)
+	defer restore()
+
+	// The audit event whose failed request opens the circuit breaker is
+	// published to the fallback transport too.
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.logout"}))
+
+	requests, _ := ps.counts()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, []interface{}{"user.login", "user.logout"}, fallback.actions())
+	if assert.Len(t, delivered, 2) {
+		assert.Equal(t, "user.login", delivered[0].Event.AuditEvent["action"])
+		assert.Equal(t, "user.logout", delivered[1].Event.AuditEvent["action"])
+	}
+}
+
+func TestHTTPTransportPublishesToFallbackWhenCircuitOpen(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 10
+	ps.failStatus = http.StatusServiceUnavailable
+
+	fallback := &recordingTransport{}
+	m := NewMemoryMetrics()
+	p, restore := newTestPublisher(ps,
+		WithMaxBatchSize(1),
+		WithWorkers(1),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+		WithCircuitBreaker(1, time.Minute),
+		WithFallbackTransport(fallback),
+		WithMetrics(m),
+	)
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.logout"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, _ := ps.counts()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, []interface{}{"user.login", "user.logout", "user.logout", "user.logout"}, fallback.actions())
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(4), s.Published)
+	assert.Empty(t, s.Failed)
+	assert.Equal(t, CircuitOpen, s.CircuitState)
+}
+
+func TestPublishContextCanceledDoesNotOpenCircuit(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.gate = make(chan struct{})
+
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithCircuitBreaker(1, time.Minute),
+	)
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, p.PublishContext(ctx, AuditEvent{"action": "user.login"}))
+	close(ps.gate)
+
+	transport := p.Options().Transport.(*HTTPSyncTransport)
+	assert.Equal(t, CircuitClosed, transport.config.breaker.State())
+}
+
+func TestSpoolTransportKeepsEventsWhileCircuitOpen(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	ps := newPublishServer(t)
+	ps.failures = 1
+	ps.failStatus = http.StatusServiceUnavailable
+
+	var failed []DeliveryReport
+	spool := NewSpoolTransport(dir)
+	p, restore := newTestPublisher(ps,
+		WithTransport(spool),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond}),
+		WithCircuitBreaker(1, 20*time.Millisecond),
+		WithOnFailed(func(dr DeliveryReport) {
+			failed = append(failed, dr)
+		}),
+	)
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+	assert.NoError(t, p.Close(context.Background()))
+
+	_, events := ps.counts()
+	assert.Equal(t, 1, events)
+	assert.Empty(t, failed)
+}
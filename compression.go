@@ -0,0 +1,167 @@
+package cased
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressionThreshold is the size in bytes a request body must reach
+// before it is compressed.
+const defaultCompressionThreshold = 1024
+
+// Codec compresses request bodies sent to Cased.
+type Codec interface {
+	// Encoding is the name of the codec, sent as the Content-Encoding of
+	// compressed request bodies.
+	Encoding() string
+
+	// Compress returns the compressed data.
+	Compress(data []byte) ([]byte, error)
+}
+
+// GzipCodec compresses request bodies with gzip at the default compression
+// level.
+var GzipCodec = NewGzipCodec(gzip.DefaultCompression)
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{
+	m: map[string]Codec{
+		GzipCodec.Encoding(): GzipCodec,
+	},
+}
+
+// RegisterCodec makes the codec available to compress request bodies with by
+// its encoding, replacing any codec previously registered with the same
+// encoding.
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.m[strings.ToLower(codec.Encoding())] = codec
+}
+
+// lookupCodec returns the registered codec for the encoding. No codec is
+// returned if compression is disabled.
+func lookupCodec(encoding string) (Codec, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	switch encoding {
+	case "", "none", "identity":
+		return nil, nil
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.m[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q", encoding)
+	}
+
+	return codec, nil
+}
+
+// codec returns the codec configured with the encoding, logging and disabling
+// compression if the encoding is unknown.
+func codec(encoding string) Codec {
+	c, err := lookupCodec(encoding)
+	if err != nil {
+		Logger.Printf("Request bodies will not be compressed: %v", err)
+	}
+
+	return c
+}
+
+// envCompressionThreshold returns the threshold configured with the
+// CASED_COMPRESSION_THRESHOLD environment variable, or the default threshold if
+// it is unset or invalid.
+func envCompressionThreshold() int {
+	value := os.Getenv("CASED_COMPRESSION_THRESHOLD")
+	if value == "" {
+		return defaultCompressionThreshold
+	}
+
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 {
+		Logger.Printf("Invalid CASED_COMPRESSION_THRESHOLD %q, using %d", value, defaultCompressionThreshold)
+		return defaultCompressionThreshold
+	}
+
+	return threshold
+}
+
+// compress compresses the data with the codec once it reaches the threshold,
+// or the default threshold if negative. The data is returned uncompressed
+// alongside an empty encoding if compression is disabled or would not make it
+// smaller.
+func compress(codec Codec, threshold int, data []byte) ([]byte, string, error) {
+	if threshold < 0 {
+		threshold = defaultCompressionThreshold
+	}
+
+	if codec == nil || len(data) < threshold {
+		return data, "", nil
+	}
+
+	compressed, err := codec.Compress(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(compressed) >= len(data) {
+		return data, "", nil
+	}
+
+	return compressed, codec.Encoding(), nil
+}
+
+type gzipCodec struct {
+	level   int
+	writers sync.Pool
+}
+
+// NewGzipCodec returns a codec that compresses request bodies with gzip at the
+// provided compression level. Invalid levels use the default compression
+// level.
+func NewGzipCodec(level int) Codec {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+
+	return &gzipCodec{level: level}
+}
+
+func (c *gzipCodec) Encoding() string {
+	return "gzip"
+}
+
+func (c *gzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, ok := c.writers.Get().(*gzip.Writer)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		var err error
+		if w, err = gzip.NewWriterLevel(&buf, c.level); err != nil {
+			return nil, err
+		}
+	}
+	defer c.writers.Put(w)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
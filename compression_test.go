@@ -0,0 +1,193 @@
+package cased
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reverseCodec struct{}
+
+func (reverseCodec) Encoding() string {
+	return "x-reverse"
+}
+
+func (reverseCodec) Compress(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data)/2)
+	for i := len(data) - 1; i >= 0; i -= 2 {
+		out = append(out, data[i])
+	}
+	return out, nil
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	out, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestCompressBelowThreshold(t *testing.T) {
+	data := []byte(strings.Repeat("a", 100))
+
+	out, encoding, err := compress(GzipCodec, 1024, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "", encoding)
+	assert.Equal(t, data, out)
+}
+
+func TestCompressAboveThreshold(t *testing.T) {
+	data := []byte(strings.Repeat("a", 2048))
+
+	out, encoding, err := compress(GzipCodec, 1024, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	assert.Less(t, len(out), len(data))
+	assert.Equal(t, data, gunzip(t, out))
+}
+
+func TestCompressZeroThreshold(t *testing.T) {
+	data := []byte(strings.Repeat("a", 100))
+
+	out, encoding, err := compress(GzipCodec, 0, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, data, gunzip(t, out))
+
+	out, encoding, err = compress(GzipCodec, -1, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "", encoding)
+	assert.Equal(t, data, out)
+}
+
+func TestEnvCompressionThreshold(t *testing.T) {
+	defer os.Unsetenv("CASED_COMPRESSION_THRESHOLD")
+
+	os.Unsetenv("CASED_COMPRESSION_THRESHOLD")
+	assert.Equal(t, 1024, envCompressionThreshold())
+
+	os.Setenv("CASED_COMPRESSION_THRESHOLD", "0")
+	assert.Equal(t, 0, envCompressionThreshold())
+
+	os.Setenv("CASED_COMPRESSION_THRESHOLD", "512")
+	assert.Equal(t, 512, envCompressionThreshold())
+
+	os.Setenv("CASED_COMPRESSION_THRESHOLD", "1kb")
+	assert.Equal(t, 1024, envCompressionThreshold())
+
+	os.Setenv("CASED_COMPRESSION_THRESHOLD", "-1")
+	assert.Equal(t, 1024, envCompressionThreshold())
+}
+
+func TestCompressSendsIncompressibleDataUncompressed(t *testing.T) {
+	data := make([]byte, 2048)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+
+	out, encoding, err := compress(GzipCodec, 1024, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "", encoding)
+	assert.Equal(t, data, out)
+}
+
+func TestLookupCodec(t *testing.T) {
+	c, err := lookupCodec("GZIP")
+	assert.NoError(t, err)
+	assert.Equal(t, GzipCodec, c)
+
+	c, err = lookupCodec("none")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+
+	_, err = lookupCodec("brotli")
+	assert.EqualError(t, err, `unknown compression codec "brotli"`)
+
+	RegisterCodec(reverseCodec{})
+	c, err = lookupCodec("x-reverse")
+	assert.NoError(t, err)
+	assert.Equal(t, reverseCodec{}, c)
+}
+
+func TestPublishCompressesLargeRequests(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithCompression("gzip"), WithCompressionThreshold(512), WithMaxBatchSize(1))
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login", "metadata": strings.Repeat("x", 1024)}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Equal(t, []string{"", "gzip"}, ps.encodings)
+	assert.Equal(t, []interface{}{"user.login", "user.login"}, ps.actions())
+}
+
+func TestEndpointCompressesLargeRequests(t *testing.T) {
+	var encoding string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding = req.Header.Get("Content-Encoding")
+		body, _ = ioutil.ReadAll(req.Body)
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	e := GetEndpointWithConfig(APIEndpoint, &EndpointConfig{
+		URL:                  String(ts.URL),
+		APIKey:               String("test"),
+		Compression:          String("gzip"),
+		CompressionThreshold: Int(64),
+	})
+
+	params := &struct {
+		Params
+		Reason string `json:"reason"`
+	}{Reason: strings.Repeat("r", 256)}
+
+	var out map[string]interface{}
+	assert.NoError(t, e.Call(http.MethodPost, "/", params, &out))
+	assert.Equal(t, "gzip", encoding)
+	assert.Contains(t, string(gunzip(t, body)), strings.Repeat("r", 256))
+}
+
+func TestEndpointCompressionThreshold(t *testing.T) {
+	var encoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding = req.Header.Get("Content-Encoding")
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	params := &struct {
+		Params
+		Reason string `json:"reason"`
+	}{Reason: strings.Repeat("r", 256)}
+
+	for threshold, expected := range map[*int]string{
+		nil:    "",
+		Int(0): "gzip",
+	} {
+		e := GetEndpointWithConfig(APIEndpoint, &EndpointConfig{
+			URL:                  String(ts.URL),
+			APIKey:               String("test"),
+			Compression:          String("gzip"),
+			CompressionThreshold: threshold,
+		})
+
+		var out map[string]interface{}
+		assert.NoError(t, e.Call(http.MethodPost, "/", params, &out))
+		assert.Equal(t, expected, encoding)
+	}
+}
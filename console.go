@@ -0,0 +1,299 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiFaint = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// ConsoleTransport prints audit events in a human friendly format instead of
+// publishing them to Cased, useful to see what an application audits during
+// local development. Sensitive values are highlighted with their labels.
+//
+// ConsoleTransport is used automatically in debug mode when no publish key is
+// configured.
+type ConsoleTransport struct {
+	// Writer is where audit events are printed.
+	Writer io.Writer
+
+	// Color highlights the output with ANSI colors.
+	Color bool
+
+	reporter reporter
+
+	mu     sync.Mutex
+	closed int32
+}
+
+// NewConsoleTransport returns a transport that prints audit events to w. Colors
+// are enabled if w is a terminal and the NO_COLOR environment variable is not
+// set.
+func NewConsoleTransport(w io.Writer) *ConsoleTransport {
+	f, ok := w.(*os.File)
+
+	return &ConsoleTransport{
+		Writer: w,
+		Color:  ok && isTerminal(f) && os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// Configure prepares the transport with provided client options.
+func (t *ConsoleTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+}
+
+func (t *ConsoleTransport) ReportsDelivery() bool {
+	return true
+}
+
+// Publish prints the audit event.
+func (t *ConsoleTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext prints the audit event.
+func (t *ConsoleTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	if atomic.LoadInt32(&t.closed) == 1 {
+		return ErrClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p := &consolePrinter{color: t.Color, pii: event.DotCased.PII}
+	p.print(event)
+
+	t.mu.Lock()
+	_, err := t.Writer.Write(p.buf.Bytes())
+	t.mu.Unlock()
+
+	t.reporter.report(event, 1, nil, err)
+	return err
+}
+
+// Flush is unused.
+func (t *ConsoleTransport) Flush(_ time.Duration) bool {
+	return true
+}
+
+// FlushContext is unused.
+func (t *ConsoleTransport) FlushContext(_ context.Context) bool {
+	return true
+}
+
+// Close stops accepting audit events.
+func (t *ConsoleTransport) Close(_ context.Context) error {
+	atomic.StoreInt32(&t.closed, 1)
+	return nil
+}
+
+// consolePrinter renders an audit event for ConsoleTransport.
+type consolePrinter struct {
+	buf   bytes.Buffer
+	color bool
+	pii   map[string][]*SensitiveRange
+}
+
+func (p *consolePrinter) print(event *AuditEventPayload) {
+	action, _ := event.AuditEvent["action"].(string)
+	if action == "" {
+		action = "(no action)"
+	}
+
+	p.style(ansiBold+ansiCyan, action)
+	if !event.DotCased.PublishedAt.IsZero() {
+		p.buf.WriteByte(' ')
+		p.style(ansiFaint, event.DotCased.PublishedAt.Format(time.RFC3339Nano))
+	}
+	p.buf.WriteByte('\n')
+
+	for _, key := range sortedKeys(event.AuditEvent) {
+		if key == "action" {
+			continue
+		}
+		p.field(1, key, pathKey("", key), event.AuditEvent[key])
+	}
+
+	p.dotCased(event.DotCased)
+	p.buf.WriteByte('\n')
+}
+
+func (p *consolePrinter) dotCased(dc DotCased) {
+	p.key(1, DotCasedKey)
+	p.buf.WriteByte('\n')
+
+	if dc.ID != "" {
+		p.key(2, "id")
+		fmt.Fprintf(&p.buf, " %s\n", dc.ID)
+	}
+
+	if dc.PublisherUserAgent != "" {
+		p.key(2, "publisher_user_agent")
+		fmt.Fprintf(&p.buf, " %s\n", dc.PublisherUserAgent)
+	}
+
+	if len(dc.PII) == 0 {
+		return
+	}
+
+	p.key(2, "pii")
+	p.buf.WriteByte('\n')
+
+	paths := make([]string, 0, len(dc.PII))
+	for path := range dc.PII {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		for _, r := range dc.PII[path] {
+			p.key(3, path)
+			fmt.Fprintf(&p.buf, " %s [%d:%d]\n", r.Label, r.Begin, r.End)
+		}
+	}
+}
+
+func (p *consolePrinter) field(depth int, key, path string, value interface{}) {
+	p.key(depth, key)
+
+	switch v := value.(type) {
+	case AuditEvent:
+		p.object(depth, path, v)
+	case map[string]interface{}:
+		p.object(depth, path, v)
+	case []interface{}:
+		p.buf.WriteByte('\n')
+		for i, e := range v {
+			p.field(depth+1, fmt.Sprintf("[%d]", i), fmt.Sprintf("%s[%d]", path, i), e)
+		}
+	case SensitiveValue:
+		p.buf.WriteByte(' ')
+		p.sensitive(v.Value, v.Ranges)
+		p.buf.WriteByte('\n')
+	case string:
+		p.buf.WriteByte(' ')
+		var ranges []SensitiveRange
+		for _, r := range p.pii[path] {
+			ranges = append(ranges, *r)
+		}
+		p.sensitive(v, ranges)
+		p.buf.WriteByte('\n')
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte(fmt.Sprint(v))
+		}
+		fmt.Fprintf(&p.buf, " %s\n", b)
+	}
+}
+
+func (p *consolePrinter) object(depth int, path string, m map[string]interface{}) {
+	p.buf.WriteByte('\n')
+	for _, key := range sortedKeys(m) {
+		p.field(depth+1, key, pathKey(path, key), m[key])
+	}
+}
+
+// sensitive writes the value with each sensitive range highlighted and followed
+// by its label.
+func (p *consolePrinter) sensitive(value string, ranges []SensitiveRange) {
+	ranges = append([]SensitiveRange(nil), ranges...)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Begin < ranges[j].Begin
+	})
+
+	offset := 0
+	for _, r := range ranges {
+		begin, end := clamp(r.Begin, offset, len(value)), clamp(r.End, offset, len(value))
+		if begin >= end {
+			continue
+		}
+
+		label := r.Label
+		if label == "" {
+			label = DefaultSensitiveLabel
+		}
+
+		p.buf.WriteString(value[offset:begin])
+		if p.color {
+			p.style(ansiRed, value[begin:end])
+			p.style(ansiFaint, "("+label+")")
+		} else {
+			fmt.Fprintf(&p.buf, "[%s](%s)", value[begin:end], label)
+		}
+		offset = end
+	}
+	p.buf.WriteString(value[offset:])
+}
+
+func (p *consolePrinter) key(depth int, key string) {
+	p.buf.WriteString(strings.Repeat("  ", depth))
+	p.style(ansiFaint, key+":")
+}
+
+func (p *consolePrinter) style(code, s string) {
+	if p.color {
+		p.buf.WriteString(code + s + ansiReset)
+	} else {
+		p.buf.WriteString(s)
+	}
+}
+
+// pathKey returns the path of the key within the audit event in the format
+// used by SensitiveDataProcessor, such as .user.email.
+func pathKey(path, key string) string {
+	if strings.IndexFunc(key, unicode.IsSpace) >= 0 {
+		key = `"` + key + `"`
+	}
+
+	return path + "." + key
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// isTerminal reports whether the file is a character device such as a
+// terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
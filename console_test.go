@@ -0,0 +1,88 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleTransportPrintsAuditEvents(t *testing.T) {
+	var buf bytes.Buffer
+	ct := NewConsoleTransport(&buf)
+	ct.Configure(PublisherOptions{})
+
+	event := NewAuditEventPayload(AuditEvent{
+		"action":   "user.login",
+		"actor":    "dewski",
+		"location": NewSensitiveValue("1.1.1.1", "ip-address"),
+		"request": map[string]interface{}{
+			"method": "POST",
+		},
+	})
+	assert.NoError(t, ct.Publish(event))
+
+	out := buf.String()
+	assert.False(t, ct.Color)
+	assert.True(t, strings.HasPrefix(out, "user.login "+event.DotCased.PublishedAt.Format(time.RFC3339Nano)+"\n"), out)
+	assert.Contains(t, out, "  actor: dewski\n")
+	assert.Contains(t, out, "  location: [1.1.1.1](ip-address)\n")
+	assert.Contains(t, out, "  request:\n    method: POST\n")
+	assert.Contains(t, out, "    id: "+event.DotCased.ID+"\n")
+	assert.Contains(t, out, "      .location: ip-address [0:7]\n")
+}
+
+func TestConsoleTransportHighlightsSensitiveRangesFromPII(t *testing.T) {
+	var buf bytes.Buffer
+	ct := NewConsoleTransport(&buf)
+	ct.Color = true
+	ct.Configure(PublisherOptions{})
+
+	// Audit events read back from JSON only have their sensitive ranges in
+	// .cased.pii.
+	event := &AuditEventPayload{
+		AuditEvent: AuditEvent{"action": "user.login", "email": "user: me@example.com"},
+		DotCased: DotCased{
+			PII: map[string][]*SensitiveRange{
+				".email": {{Begin: 6, End: 20, Label: "email"}},
+			},
+		},
+	}
+	assert.NoError(t, ct.Publish(event))
+
+	assert.Contains(t, buf.String(), "user: "+ansiRed+"me@example.com"+ansiReset+ansiFaint+"(email)"+ansiReset+"\n")
+}
+
+func TestConsoleTransportReportsDeliveredEvents(t *testing.T) {
+	dr := &deliveryReports{}
+	opts := PublisherOptions{}
+	for _, opt := range dr.options() {
+		opt(&opts)
+	}
+
+	ct := NewConsoleTransport(&bytes.Buffer{})
+	ct.Configure(opts)
+
+	assert.NoError(t, ct.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"})))
+	assert.Len(t, dr.delivered, 1)
+
+	assert.NoError(t, ct.Close(context.Background()))
+	assert.Equal(t, ErrClosed, ct.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"})))
+}
+
+func TestDebugWithoutPublishKeyUsesConsoleTransport(t *testing.T) {
+	defer restoreEnv("CASED_PUBLISH_KEY")()
+	defer restoreEnv("CASED_DEBUG")()
+	os.Unsetenv("CASED_PUBLISH_KEY")
+	os.Unsetenv("CASED_DEBUG")
+
+	p := NewPublisher(WithDebug(true)).(*Client)
+	assert.IsType(t, &ConsoleTransport{}, p.transport)
+
+	p = NewPublisher().(*Client)
+	assert.IsType(t, &NoopHTTPTransport{}, p.transport)
+}
@@ -0,0 +1,190 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// DeliveryReport describes the outcome of publishing an audit event.
+type DeliveryReport struct {
+	// Event is the audit event that was published.
+	Event *AuditEventPayload
+
+	// Attempts is the number of requests made to publish the audit event. It
+	// is zero if the audit event was dropped before it could be published.
+	Attempts int
+
+	// StatusCode is the HTTP status of the last attempt, if any.
+	StatusCode int
+
+	// Err is the reason the audit event could not be published, nil if it was
+	// delivered or dropped.
+	Err error
+
+	// Dropped is set if a processor dropped the audit event with ErrDropEvent,
+	// so it was intentionally not published.
+	Dropped bool
+}
+
+// DeliveryReporter is implemented by transports that report the outcome of
+// each audit event they accept with the OnDelivered and OnFailed hooks of the
+// options they are configured with, such as the transports in this package.
+// Audit events accepted by transports that do not implement DeliveryReporter,
+// or report false, are considered delivered once PublishContext returns without
+// an error.
+type DeliveryReporter interface {
+	// ReportsDelivery reports whether the transport calls OnDelivered or
+	// OnFailed exactly once for each audit event it is asked to publish,
+	// except those rejected with ErrClosed.
+	ReportsDelivery() bool
+}
+
+// reportsDelivery reports whether the transport reports the outcome of each
+// audit event it accepts.
+func reportsDelivery(transport Transporter) bool {
+	dr, ok := transport.(DeliveryReporter)
+	return ok && dr.ReportsDelivery()
+}
+
+// reporter notifies the delivery hooks configured with PublisherOptions.
+type reporter struct {
+	onDelivered func(DeliveryReport)
+	onFailed    func(DeliveryReport)
+}
+
+func newReporter(options PublisherOptions) reporter {
+	return reporter{
+		onDelivered: options.OnDelivered,
+		onFailed:    options.OnFailed,
+	}
+}
+
+func (r reporter) report(event *AuditEventPayload, attempts int, resp *http.Response, err error) {
+	dr := DeliveryReport{
+		Event:    event,
+		Attempts: attempts,
+		Err:      err,
+	}
+
+	var pe *PublishError
+	if resp != nil {
+		dr.StatusCode = resp.StatusCode
+	} else if errors.As(err, &pe) {
+		dr.StatusCode = pe.StatusCode
+	}
+
+	r.send(dr)
+}
+
+// send calls the delivery hook matching the outcome of the report.
+func (r reporter) send(dr DeliveryReport) {
+	if dr.Err == nil {
+		if r.onDelivered != nil {
+			r.onDelivered(dr)
+		}
+	} else if r.onFailed != nil {
+		r.onFailed(dr)
+	}
+}
+
+// PublishResult is a handle to the outcome of an audit event published with
+// Client.PublishAsync.
+type PublishResult struct {
+	done   chan struct{}
+	once   sync.Once
+	report DeliveryReport
+}
+
+func newPublishResult() *PublishResult {
+	return &PublishResult{
+		done: make(chan struct{}),
+	}
+}
+
+func (r *PublishResult) resolve(report DeliveryReport) {
+	r.once.Do(func() {
+		r.report = report
+		close(r.done)
+	})
+}
+
+// Done returns a channel that is closed once the audit event has been
+// delivered or failed to be delivered.
+func (r *PublishResult) Done() <-chan struct{} {
+	return r.done
+}
+
+// Report returns the delivery report of the audit event. It is only valid once
+// Done is closed.
+func (r *PublishResult) Report() DeliveryReport {
+	<-r.done
+	return r.report
+}
+
+// Wait waits for the audit event to be delivered and returns the reason it
+// could not be delivered, or the context's error if the context is done first.
+func (r *PublishResult) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.report.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publishResults tracks the results of audit events published with
+// Client.PublishAsync until they are reported by the transport.
+type publishResults struct {
+	mu      sync.Mutex
+	pending map[*AuditEventPayload]*PublishResult
+}
+
+func newPublishResults() *publishResults {
+	return &publishResults{
+		pending: map[*AuditEventPayload]*PublishResult{},
+	}
+}
+
+func (pr *publishResults) add(event *AuditEventPayload) *PublishResult {
+	result := newPublishResult()
+
+	pr.mu.Lock()
+	pr.pending[event] = result
+	pr.mu.Unlock()
+
+	return result
+}
+
+func (pr *publishResults) resolve(report DeliveryReport) {
+	pr.mu.Lock()
+	result, ok := pr.pending[report.Event]
+	delete(pr.pending, report.Event)
+	pr.mu.Unlock()
+
+	if ok {
+		result.resolve(report)
+	}
+}
+
+// hooks wraps the delivery hooks so results are resolved before the hooks
+// configured by the application are called.
+func (pr *publishResults) hooks(options PublisherOptions) PublisherOptions {
+	onDelivered, onFailed := options.OnDelivered, options.OnFailed
+
+	options.OnDelivered = func(report DeliveryReport) {
+		pr.resolve(report)
+		if onDelivered != nil {
+			onDelivered(report)
+		}
+	}
+	options.OnFailed = func(report DeliveryReport) {
+		pr.resolve(report)
+		if onFailed != nil {
+			onFailed(report)
+		}
+	}
+
+	return options
+}
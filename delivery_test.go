@@ -0,0 +1,264 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type deliveryReports struct {
+	mu        sync.Mutex
+	delivered []DeliveryReport
+	failed    []DeliveryReport
+}
+
+func (dr *deliveryReports) options() []PublisherOption {
+	return []PublisherOption{
+		WithOnDelivered(func(r DeliveryReport) {
+			dr.mu.Lock()
+			defer dr.mu.Unlock()
+			dr.delivered = append(dr.delivered, r)
+		}),
+		WithOnFailed(func(r DeliveryReport) {
+			dr.mu.Lock()
+			defer dr.mu.Unlock()
+			dr.failed = append(dr.failed, r)
+		}),
+	}
+}
+
+func TestOnDeliveredIsCalledForPublishedEvents(t *testing.T) {
+	ps := newPublishServer(t)
+	dr := &deliveryReports{}
+	p, restore := newTestPublisher(ps, dr.options()...)
+	defer restore()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Len(t, dr.delivered, 3)
+	assert.Len(t, dr.failed, 0)
+	for _, r := range dr.delivered {
+		assert.Equal(t, "user.login", r.Event.AuditEvent["action"])
+		assert.Equal(t, 1, r.Attempts)
+		assert.Equal(t, http.StatusCreated, r.StatusCode)
+		assert.NoError(t, r.Err)
+	}
+}
+
+func TestOnFailedIsCalledWhenRetriesAreExhausted(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 2
+	ps.failStatus = http.StatusServiceUnavailable
+	dr := &deliveryReports{}
+	opts := append(dr.options(), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	p, restore := newTestPublisher(ps, opts...)
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Len(t, dr.delivered, 0)
+	if assert.Len(t, dr.failed, 1) {
+		assert.Equal(t, 2, dr.failed[0].Attempts)
+		assert.Equal(t, http.StatusServiceUnavailable, dr.failed[0].StatusCode)
+		assert.Error(t, dr.failed[0].Err)
+	}
+}
+
+func TestOnFailedIsCalledForDroppedEvents(t *testing.T) {
+	dr := &deliveryReports{}
+	opts := append(dr.options(), WithOverflowPolicy(OverflowDropNewest))
+	ps, p, restore := newOverflowTestPublisher(t, opts...)
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	assert.Equal(t, ErrQueueFull, p.Publish(AuditEvent{"action": "user.third"}))
+	close(ps.gate)
+	assert.True(t, p.Flush(5*time.Second))
+
+	if assert.Len(t, dr.failed, 1) {
+		assert.Equal(t, "user.third", dr.failed[0].Event.AuditEvent["action"])
+		assert.Equal(t, 0, dr.failed[0].Attempts)
+		assert.Equal(t, ErrQueueFull, dr.failed[0].Err)
+	}
+}
+
+func TestPublishAsyncResolvesOnceDelivered(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps)
+	defer restore()
+
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, result.Wait(ctx))
+	assert.Equal(t, 1, result.Report().Attempts)
+	assert.Equal(t, []interface{}{"user.login"}, ps.actions())
+}
+
+func TestPublishAsyncResolvesOnceFailed(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 1
+	ps.failStatus = http.StatusForbidden
+	p, restore := newTestPublisher(ps)
+	defer restore()
+
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := result.Wait(ctx)
+
+	var pe *PublishError
+	if assert.True(t, errors.As(err, &pe), err) {
+		assert.Equal(t, http.StatusForbidden, pe.StatusCode)
+	}
+}
+
+func TestPublishAsyncResolvesWhenPublishFails(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps)
+	defer restore()
+
+	assert.NoError(t, p.Close(context.Background()))
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+
+	<-result.Done()
+	assert.Equal(t, ErrClosed, result.Report().Err)
+}
+
+// unreportedTransport accepts audit events without reporting their outcome,
+// like transports implemented outside of this package.
+type unreportedTransport struct {
+	err error
+}
+
+func (t *unreportedTransport) Configure(_ PublisherOptions) {}
+
+func (t *unreportedTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+func (t *unreportedTransport) PublishContext(_ context.Context, _ *AuditEventPayload) error {
+	return t.err
+}
+
+func (t *unreportedTransport) Flush(_ time.Duration) bool {
+	return true
+}
+
+func (t *unreportedTransport) FlushContext(_ context.Context) bool {
+	return true
+}
+
+func (t *unreportedTransport) Close(_ context.Context) error {
+	return nil
+}
+
+func TestPublishAsyncResolvesWithTransportWithoutReports(t *testing.T) {
+	transport := &unreportedTransport{}
+	c := NewPublisher(WithTransport(transport)).(*Client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := c.PublishAsync(ctx, AuditEvent{"action": "user.login"})
+	assert.NoError(t, result.Wait(ctx))
+
+	transport.err = errDestination
+	result = c.PublishAsync(ctx, AuditEvent{"action": "user.login"})
+	assert.Equal(t, errDestination, result.Wait(ctx))
+
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+	assert.Empty(t, c.results.pending)
+}
+
+func TestSpoolTransportReportsDeliveredEvents(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	dr := &deliveryReports{}
+	opts := PublisherOptions{}
+	for _, opt := range dr.options() {
+		opt(&opts)
+	}
+
+	st := NewSpoolTransport(dir)
+	st.Transport = &recordingTransport{}
+	st.Configure(opts)
+
+	event := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.NoError(t, st.Publish(event))
+	assert.True(t, st.Flush(5*time.Second))
+
+	if assert.Len(t, dr.delivered, 1) {
+		assert.Same(t, event, dr.delivered[0].Event)
+	}
+}
+
+func assertPublishAsyncResolves(t *testing.T, c *Client, actions ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var results []*PublishResult
+	for _, action := range actions {
+		results = append(results, c.PublishAsync(ctx, AuditEvent{"action": action}))
+	}
+	for _, result := range results {
+		assert.NoError(t, result.Wait(ctx))
+	}
+
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+	assert.Empty(t, c.results.pending)
+}
+
+func TestHTTPTransportReportsEventsSpilledToTransportWithoutReports(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t, WithOverflowTransport(&unreportedTransport{}))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	assertPublishAsyncResolves(t, p.(*Client), "user.third", "user.fourth")
+	close(ps.gate)
+
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.second"}, ps.actions())
+}
+
+func TestHTTPTransportReportsEventsPublishedToFallbackWithoutReports(t *testing.T) {
+	for name, transport := range map[string]Transporter{
+		"async": NewHTTPTransport(),
+		"sync":  NewHTTPSyncTransport(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ps := newPublishServer(t)
+			ps.failures = 10
+			ps.failStatus = http.StatusServiceUnavailable
+
+			p, restore := newTestPublisher(ps,
+				WithTransport(transport),
+				WithMaxBatchSize(1),
+				WithWorkers(1),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+				WithCircuitBreaker(1, time.Minute),
+				WithFallbackTransport(&unreportedTransport{}),
+			)
+			defer restore()
+
+			assertPublishAsyncResolves(t, p.(*Client), "user.login", "user.logout", "user.logout")
+
+			requests, _ := ps.counts()
+			assert.Equal(t, 1, requests)
+		})
+	}
+}
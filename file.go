@@ -0,0 +1,514 @@
+package cased
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFileMaxBytes     = 100 << 20
+	defaultFileSyncInterval = time.Second
+
+	fileRotatedTimeFormat = "20060102T150405.000000000"
+	fileCompressedExt     = ".gz"
+)
+
+// FsyncPolicy determines when FileTransport syncs written audit events to
+// disk.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs the file after each audit event is written, audit events
+	// are only reported as delivered once synced.
+	FsyncAlways FsyncPolicy = "always"
+
+	// FsyncInterval syncs the file periodically, audit events written since
+	// the last sync may be lost if the machine crashes.
+	FsyncInterval FsyncPolicy = "interval"
+
+	// FsyncNever leaves syncing the file to the operating system. The file is
+	// still synced when it is rotated or closed.
+	FsyncNever FsyncPolicy = "never"
+)
+
+// FileTransport writes audit events to a local file as JSON Lines, one audit
+// event per line, for deployments without network access to Cased.
+//
+// The file is rotated once it reaches MaxBytes or MaxAge. Rotated files are
+// renamed with the time they were rotated, for example audit.jsonl is rotated
+// to audit-20210102T150405.000000000.jsonl, optionally compressed with gzip,
+// and only the most recent MaxGenerations rotated files are kept.
+type FileTransport struct {
+	// Path is the file audit events are written to.
+	Path string
+
+	// MaxBytes is the size at which the file is rotated. The file is not
+	// rotated by size if zero.
+	MaxBytes int64
+
+	// MaxAge is the time after which the file is rotated, checked as audit
+	// events are written. The age of an existing file is measured from the time
+	// its first audit event was published, or from when it was last modified
+	// if unknown, so restarts do not postpone rotation. The file is not
+	// rotated by age if zero.
+	MaxAge time.Duration
+
+	// MaxGenerations is the number of rotated files kept. All rotated files are
+	// kept if zero.
+	MaxGenerations int
+
+	// Compress compresses rotated files with gzip.
+	Compress bool
+
+	// Fsync determines when written audit events are synced to disk. Defaults
+	// to FsyncAlways.
+	Fsync FsyncPolicy
+
+	// SyncInterval is how often the file is synced with FsyncInterval.
+	SyncInterval time.Duration
+
+	reporter reporter
+
+	mu      sync.Mutex
+	err     error
+	file    eventWriter
+	size    int64
+	created time.Time
+	dirty   bool
+	closed  bool
+	stop    chan struct{}
+	rotated sync.WaitGroup
+	pruneMu sync.Mutex
+
+	start sync.Once
+}
+
+// NewFileTransport returns a transport that writes audit events to the file at
+// path.
+func NewFileTransport(path string) *FileTransport {
+	return &FileTransport{
+		Path:         path,
+		MaxBytes:     defaultFileMaxBytes,
+		Fsync:        FsyncAlways,
+		SyncInterval: defaultFileSyncInterval,
+	}
+}
+
+// Configure opens the file audit events are written to.
+func (t *FileTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+
+	switch t.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		t.Fsync = FsyncAlways
+	}
+
+	t.start.Do(func() {
+		t.stop = make(chan struct{})
+
+		if err := t.open(); err != nil {
+			Logger.Printf("Could not open audit event file %s: %v", t.Path, err)
+			t.err = err
+			return
+		}
+
+		if t.Fsync == FsyncInterval {
+			go t.syncer()
+		}
+	})
+}
+
+func (t *FileTransport) ReportsDelivery() bool {
+	return true
+}
+
+// Publish writes the audit event to the file.
+func (t *FileTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext writes the audit event to the file.
+func (t *FileTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.reporter.report(event, 0, nil, err)
+		return err
+	}
+	data = append(data, '\n')
+
+	err = t.write(data)
+	if err == ErrClosed {
+		return err
+	}
+
+	t.reporter.report(event, 1, nil, err)
+	return err
+}
+
+func (t *FileTransport) write(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if t.size > 0 && t.shouldRotate(len(data)) {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := t.file.Write(data)
+	if err != nil {
+		if n > 0 {
+			t.discardPartialWrite(n)
+		}
+		return err
+	}
+	t.size += int64(n)
+
+	t.dirty = true
+	if t.Fsync == FsyncAlways {
+		return t.sync()
+	}
+
+	return nil
+}
+
+// discardPartialWrite truncates the partially written audit event from the
+// file so the next audit event is not appended to it. If the file cannot be
+// truncated it is rotated instead, leaving the partial audit event at the end
+// of the rotated file.
+func (t *FileTransport) discardPartialWrite(n int) {
+	err := t.file.Truncate(t.size)
+	if err == nil {
+		return
+	}
+
+	Logger.Printf("Unable to truncate partially written audit event from %s: %v", t.Path, err)
+	t.size += int64(n)
+	if err := t.rotate(); err != nil {
+		t.err = err
+	}
+}
+
+// Flush syncs written audit events to disk.
+func (t *FileTransport) Flush(_ time.Duration) bool {
+	return t.FlushContext(context.Background())
+}
+
+// FlushContext syncs written audit events to disk.
+func (t *FileTransport) FlushContext(_ context.Context) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil || t.closed {
+		return t.err == nil
+	}
+
+	if err := t.sync(); err != nil {
+		Logger.Printf("Could not sync audit event file %s: %v", t.Path, err)
+		return false
+	}
+
+	return true
+}
+
+// Close syncs and closes the file, and waits for rotated files to be
+// compressed until the context is done.
+func (t *FileTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed || t.err != nil || t.file == nil {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.stop)
+
+	err := t.sync()
+	if cerr := t.file.Close(); err == nil {
+		err = cerr
+	}
+	t.mu.Unlock()
+
+	compressed := make(chan struct{})
+	go func() {
+		t.rotated.Wait()
+		close(compressed)
+	}()
+
+	select {
+	case <-compressed:
+	case <-ctx.Done():
+		Logger.Printf("Closed audit event file before rotated files were compressed: %v", ctx.Err())
+	}
+
+	return err
+}
+
+func (t *FileTransport) open() error {
+	if err := os.MkdirAll(filepath.Dir(t.Path), spoolDirPerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, spoolFilePerm)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	t.file = f
+	t.size = fi.Size()
+	t.created = fileCreated(t.Path, fi)
+	t.dirty = false
+
+	return nil
+}
+
+// fileCreated returns when the file was started: the time its first audit
+// event was published, or the time it was last modified if unknown, such as
+// for empty files.
+func fileCreated(path string, fi os.FileInfo) time.Time {
+	created := fi.ModTime()
+	if fi.Size() == 0 {
+		return created
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return created
+	}
+	defer f.Close()
+
+	var first struct {
+		DotCased struct {
+			PublishedAt time.Time `json:"published_at"`
+		} `json:".cased"`
+	}
+	if err := json.NewDecoder(f).Decode(&first); err != nil {
+		return created
+	}
+
+	if publishedAt := first.DotCased.PublishedAt; !publishedAt.IsZero() && publishedAt.Before(created) {
+		return publishedAt
+	}
+
+	return created
+}
+
+func (t *FileTransport) shouldRotate(n int) bool {
+	if t.MaxBytes > 0 && t.size+int64(n) > t.MaxBytes {
+		return true
+	}
+
+	return t.MaxAge > 0 && time.Since(t.created) >= t.MaxAge
+}
+
+// rotate renames the current file with the time it was rotated and opens a new
+// file. The rotated file is compressed and old generations are removed in the
+// background.
+func (t *FileTransport) rotate() error {
+	if err := t.sync(); err != nil {
+		return err
+	}
+
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := t.rotatedPath(time.Now())
+	if err := os.Rename(t.Path, rotated); err != nil {
+		// Keep writing to the current file until it can be rotated.
+		if oerr := t.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+
+	if err := t.open(); err != nil {
+		return err
+	}
+
+	t.rotated.Add(1)
+	go func() {
+		defer t.rotated.Done()
+
+		if t.Compress {
+			if err := compressFile(rotated); err != nil {
+				Logger.Printf("Could not compress rotated audit event file %s: %v", rotated, err)
+			}
+		}
+
+		if err := t.prune(); err != nil {
+			Logger.Printf("Could not remove old audit event files: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// sync syncs the file if audit events were written since it was last synced.
+func (t *FileTransport) sync() error {
+	if !t.dirty {
+		return nil
+	}
+
+	if err := t.file.Sync(); err != nil {
+		return err
+	}
+
+	t.dirty = false
+	return nil
+}
+
+func (t *FileTransport) syncer() {
+	interval := t.SyncInterval
+	if interval <= 0 {
+		interval = defaultFileSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.FlushContext(context.Background())
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *FileTransport) rotatedPath(now time.Time) string {
+	ext := filepath.Ext(t.Path)
+	base := strings.TrimSuffix(t.Path, ext)
+
+	return base + "-" + now.UTC().Format(fileRotatedTimeFormat) + ext
+}
+
+// generations returns the rotated files grouped by the time they were rotated,
+// oldest first. A generation has both an uncompressed and a compressed file
+// while it is being compressed.
+func (t *FileTransport) generations() ([][]string, error) {
+	ext := filepath.Ext(t.Path)
+	base := strings.TrimSuffix(t.Path, ext)
+
+	matches, err := filepath.Glob(base + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]string{}
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimSuffix(match, fileCompressedExt), ext)
+		stamp = strings.TrimPrefix(stamp, base+"-")
+		if _, err := time.Parse(fileRotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+
+		files[stamp] = append(files[stamp], match)
+	}
+
+	stamps := make([]string, 0, len(files))
+	for stamp := range files {
+		stamps = append(stamps, stamp)
+	}
+	sort.Strings(stamps)
+
+	generations := make([][]string, len(stamps))
+	for i, stamp := range stamps {
+		generations[i] = files[stamp]
+	}
+
+	return generations, nil
+}
+
+// prune removes the oldest rotated files beyond the number of generations to
+// keep.
+func (t *FileTransport) prune() error {
+	if t.MaxGenerations <= 0 {
+		return nil
+	}
+
+	t.pruneMu.Lock()
+	defer t.pruneMu.Unlock()
+
+	generations, err := t.generations()
+	if err != nil {
+		return err
+	}
+
+	for ; len(generations) > t.MaxGenerations; generations = generations[1:] {
+		for _, file := range generations[0] {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compressFile compresses the file with gzip and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+fileCompressedExt, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, spoolFilePerm)
+	if err != nil {
+		return err
+	}
+
+	if err := writeCompressed(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func writeCompressed(dst *os.File, src io.Reader) error {
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return dst.Sync()
+}
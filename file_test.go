@@ -0,0 +1,228 @@
+package cased
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readJSONLines(t *testing.T, path string) []AuditEventPayload {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+
+	var r = bufio.NewScanner(f)
+	if strings.HasSuffix(path, fileCompressedExt) {
+		zr, err := gzip.NewReader(f)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		r = bufio.NewScanner(zr)
+	}
+
+	var events []AuditEventPayload
+	for r.Scan() {
+		var event AuditEventPayload
+		assert.NoError(t, json.Unmarshal(r.Bytes(), &event))
+		events = append(events, event)
+	}
+	assert.NoError(t, r.Err())
+
+	return events
+}
+
+func TestFileTransportWritesJSONLines(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	dr := &deliveryReports{}
+	opts := PublisherOptions{}
+	for _, opt := range dr.options() {
+		opt(&opts)
+	}
+
+	path := filepath.Join(dir, "audit.jsonl")
+	ft := NewFileTransport(path)
+	ft.Configure(opts)
+
+	for _, action := range []string{"user.login", "user.logout"} {
+		assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": action})))
+	}
+	assert.NoError(t, ft.Close(context.Background()))
+
+	events := readJSONLines(t, path)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "user.login", events[0].AuditEvent["action"])
+		assert.Equal(t, "user.logout", events[1].AuditEvent["action"])
+		assert.NotEmpty(t, events[0].DotCased.ID)
+	}
+	assert.Len(t, dr.delivered, 2)
+	assert.Equal(t, ErrClosed, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.delete"})))
+}
+
+func TestFileTransportRotatesBySize(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	ft := NewFileTransport(path)
+	ft.MaxBytes = 1
+	ft.MaxGenerations = 2
+	ft.Configure(PublisherOptions{})
+
+	for _, action := range []string{"user.one", "user.two", "user.three", "user.four"} {
+		assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": action})))
+	}
+	assert.NoError(t, ft.Close(context.Background()))
+
+	generations, err := ft.generations()
+	assert.NoError(t, err)
+	if assert.Len(t, generations, 2) {
+		assert.Equal(t, "user.two", readJSONLines(t, generations[0][0])[0].AuditEvent["action"])
+		assert.Equal(t, "user.three", readJSONLines(t, generations[1][0])[0].AuditEvent["action"])
+	}
+	assert.Equal(t, "user.four", readJSONLines(t, path)[0].AuditEvent["action"])
+}
+
+func TestFileTransportCompressesRotatedFiles(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	ft := NewFileTransport(path)
+	ft.MaxBytes = 1
+	ft.Compress = true
+	ft.Configure(PublisherOptions{})
+
+	for _, action := range []string{"user.one", "user.two"} {
+		assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": action})))
+	}
+	assert.NoError(t, ft.Close(context.Background()))
+
+	generations, err := ft.generations()
+	assert.NoError(t, err)
+	if assert.Len(t, generations, 1) && assert.Len(t, generations[0], 1) {
+		assert.True(t, strings.HasSuffix(generations[0][0], ".jsonl.gz"), generations[0][0])
+		assert.Equal(t, "user.one", readJSONLines(t, generations[0][0])[0].AuditEvent["action"])
+	}
+}
+
+func TestFileTransportRotatesByAge(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	ft := NewFileTransport(path)
+	ft.MaxAge = 10 * time.Millisecond
+	ft.Configure(PublisherOptions{})
+
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.one"})))
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.two"})))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.three"})))
+	assert.NoError(t, ft.Close(context.Background()))
+
+	generations, err := ft.generations()
+	assert.NoError(t, err)
+	if assert.Len(t, generations, 1) {
+		assert.Len(t, readJSONLines(t, generations[0][0]), 2)
+	}
+	assert.Len(t, readJSONLines(t, path), 1)
+}
+
+func TestFileTransportRotatesExistingFileByAge(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	aep := NewAuditEventPayload(AuditEvent{"action": "user.one"})
+	aep.DotCased.PublishedAt = time.Now().Add(-2 * time.Hour)
+	data, err := json.Marshal(aep)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(path, append(data, '\n'), spoolFilePerm))
+
+	// The file was last written recently, but its first audit event is older
+	// than MaxAge.
+	ft := NewFileTransport(path)
+	ft.MaxAge = time.Hour
+	ft.Configure(PublisherOptions{})
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.two"})))
+	assert.NoError(t, ft.Close(context.Background()))
+
+	generations, err := ft.generations()
+	assert.NoError(t, err)
+	assert.Len(t, generations, 1)
+	assert.Len(t, readJSONLines(t, path), 1)
+
+	// Without a published time, the age of the file is measured from when it
+	// was last modified.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{}\n"), spoolFilePerm))
+	modified := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+
+	ft = NewFileTransport(path)
+	ft.MaxAge = time.Hour
+	ft.Configure(PublisherOptions{})
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.three"})))
+	assert.NoError(t, ft.Close(context.Background()))
+
+	generations, err = ft.generations()
+	assert.NoError(t, err)
+	assert.Len(t, generations, 2)
+	assert.Len(t, readJSONLines(t, path), 1)
+}
+
+func TestFileTransportDiscardsPartialWrites(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	ft := NewFileTransport(path)
+	ft.Configure(PublisherOptions{})
+
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.one"})))
+
+	ft.mu.Lock()
+	ft.file = &shortWriter{eventWriter: ft.file}
+	ft.mu.Unlock()
+
+	assert.Equal(t, io.ErrShortWrite, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.two"})))
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.three"})))
+	assert.NoError(t, ft.Close(context.Background()))
+
+	var actions []interface{}
+	for _, event := range readJSONLines(t, path) {
+		actions = append(actions, event.AuditEvent["action"])
+	}
+	assert.Equal(t, []interface{}{"user.one", "user.three"}, actions)
+}
+
+func TestFileTransportFsyncInterval(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	ft := NewFileTransport(filepath.Join(dir, "audit.jsonl"))
+	ft.Fsync = FsyncInterval
+	ft.SyncInterval = time.Millisecond
+	ft.Configure(PublisherOptions{})
+
+	assert.NoError(t, ft.Publish(NewAuditEventPayload(AuditEvent{"action": "user.one"})))
+	assert.Eventually(t, func() bool {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		return !ft.dirty
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, ft.Close(context.Background()))
+}
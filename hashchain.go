@@ -0,0 +1,363 @@
+package cased
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// HashChainHead is the last link of a hash chain.
+type HashChainHead struct {
+	// Sequence is the sequence number of the last audit event in the chain.
+	Sequence uint64 `json:"sequence"`
+
+	// Hash is the hash of the last audit event in the chain.
+	Hash string `json:"hash"`
+}
+
+// HashChain links audit events together so removing or altering any of them
+// can be detected. Each audit event is assigned the next sequence number and
+// the hash of the previous audit event in its .cased metadata, see
+// VerifyHashChain.
+//
+// The head of the chain is persisted so the chain continues across restarts.
+// Each process must use its own head file.
+//
+// Audit events are linked before they are delivered, so audit events that fail
+// to be published leave gaps in the chain. VerifyHashChain reports these gaps,
+// which are expected for audit events that were not delivered.
+type HashChain struct {
+	path string
+
+	mu   sync.Mutex
+	head HashChainHead
+}
+
+// NewHashChain returns a hash chain that persists its head to the file at
+// path, continuing from the head already persisted there. The head is only
+// kept in memory if path is empty.
+func NewHashChain(path string) (*HashChain, error) {
+	c := &HashChain{path: path}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.head); err != nil {
+		return nil, fmt.Errorf("cased: invalid hash chain head %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Head returns the last link of the chain.
+func (c *HashChain) Head() HashChainHead {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.head
+}
+
+// Process links the audit event to the chain. It must be the last processor
+// so the audit event is not changed after it is hashed:
+//
+//	chain, err := cased.NewHashChain("/var/lib/myapp/cased-chain.json")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	p := cased.NewPublisher(
+//		cased.WithProcessors(append(cased.DefaultProcessors(), chain.Process)...),
+//	)
+//
+// The audit event is rejected with an error if it cannot be hashed or the new
+// head cannot be persisted, leaving the head unchanged.
+func (c *HashChain) Process(ctx context.Context, aep *AuditEventPayload) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	aep.DotCased.Sequence = c.head.Sequence + 1
+	aep.DotCased.PreviousHash = c.head.Hash
+
+	hash, err := hashPayload(aep)
+	if err != nil {
+		return fmt.Errorf("cased: could not hash audit event: %w", err)
+	}
+
+	head := HashChainHead{Sequence: aep.DotCased.Sequence, Hash: hash}
+	if err := c.save(head); err != nil {
+		return fmt.Errorf("cased: could not save hash chain head: %w", err)
+	}
+	c.head = head
+
+	return nil
+}
+
+// save atomically and durably persists the head to disk.
+func (c *HashChain) save(head HashChainHead) error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), spoolDirPerm); err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, spoolFilePerm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(c.path))
+}
+
+// syncDir flushes the directory so renames within it survive a crash.
+// Directories cannot be synced on Windows, where renames are already durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// hashPayload returns the hex encoded SHA-256 hash of the canonical encoding
+// of the audit event payload.
+func hashPayload(aep *AuditEventPayload) (string, error) {
+	data, err := json.Marshal(aep)
+	if err != nil {
+		return "", err
+	}
+
+	return hashJSON(data)
+}
+
+// hashJSON returns the hex encoded SHA-256 hash of the canonical encoding of
+// the encoded audit event payload, excluding its signature which is added
+// after the audit event is linked. Encoded audit events are hashed as they
+// were read so values are not changed by decoding them, such as large numbers
+// losing precision.
+func hashJSON(data []byte) (string, error) {
+	canonical, err := canonicalPayload(data, signatureField, keyIDField)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainBreakReason describes how a hash chain was broken.
+type ChainBreakReason string
+
+const (
+	// ChainGap means audit events are missing before the audit event.
+	ChainGap ChainBreakReason = "gap"
+
+	// ChainModified means the previous audit event does not match the hash
+	// recorded in the audit event, it was altered or replaced.
+	ChainModified ChainBreakReason = "modified"
+
+	// ChainDuplicate means more than one audit event has the sequence number.
+	ChainDuplicate ChainBreakReason = "duplicate"
+
+	// ChainUnlinked means the audit event has no sequence number.
+	ChainUnlinked ChainBreakReason = "unlinked"
+
+	// ChainMalformed means the line could not be decoded as an audit event.
+	ChainMalformed ChainBreakReason = "malformed"
+)
+
+// ChainBreak is a place where a hash chain does not hold.
+type ChainBreak struct {
+	// Line is the line of the audit event in the stream, starting at 1.
+	Line int
+
+	// Sequence is the sequence number of the audit event.
+	Sequence uint64
+
+	// Reason describes how the chain was broken.
+	Reason ChainBreakReason
+
+	// Missing is the number of audit events missing for ChainGap.
+	Missing uint64
+}
+
+func (b ChainBreak) String() string {
+	switch b.Reason {
+	case ChainGap:
+		return fmt.Sprintf("line %d: %d audit events missing before sequence %d", b.Line, b.Missing, b.Sequence)
+	case ChainModified:
+		return fmt.Sprintf("line %d: audit event before sequence %d was modified", b.Line, b.Sequence)
+	case ChainDuplicate:
+		return fmt.Sprintf("line %d: duplicate sequence %d", b.Line, b.Sequence)
+	default:
+		return fmt.Sprintf("line %d: %s", b.Line, b.Reason)
+	}
+}
+
+// ChainVerification is the result of verifying a hash chain.
+type ChainVerification struct {
+	// Events is the number of audit events verified.
+	Events int
+
+	// Head is the last link of the verified chain, which can be compared to
+	// the head persisted by HashChain to detect audit events removed from the
+	// end of the stream.
+	Head HashChainHead
+
+	// Breaks are the places where the chain does not hold.
+	Breaks []ChainBreak
+}
+
+// Valid reports whether the chain holds.
+func (v ChainVerification) Valid() bool {
+	return len(v.Breaks) == 0
+}
+
+// chainLink is an audit event read from a stream being verified.
+type chainLink struct {
+	line     int
+	sequence uint64
+	previous string
+	hash     string
+}
+
+// readChainLink decodes the audit event on the line, recording a break if it
+// cannot be linked.
+func readChainLink(line int, data []byte, v *ChainVerification) (chainLink, bool) {
+	var aep AuditEventPayload
+	if err := json.Unmarshal(data, &aep); err != nil {
+		v.Breaks = append(v.Breaks, ChainBreak{Line: line, Reason: ChainMalformed})
+		return chainLink{}, false
+	}
+
+	if aep.DotCased.Sequence == 0 {
+		v.Breaks = append(v.Breaks, ChainBreak{Line: line, Reason: ChainUnlinked})
+		return chainLink{}, false
+	}
+
+	hash, err := hashJSON(data)
+	if err != nil {
+		v.Breaks = append(v.Breaks, ChainBreak{Line: line, Sequence: aep.DotCased.Sequence, Reason: ChainMalformed})
+		return chainLink{}, false
+	}
+
+	return chainLink{
+		line:     line,
+		sequence: aep.DotCased.Sequence,
+		previous: aep.DotCased.PreviousHash,
+		hash:     hash,
+	}, true
+}
+
+// VerifyHashChain reads audit events linked with HashChain from a JSON Lines
+// stream, such as one written by FileTransport, and reports any gaps in the
+// sequence or audit events that were modified. Audit events may appear in the
+// stream out of order. The chain is verified from the first sequence number in
+// the stream.
+func VerifyHashChain(r io.Reader) (ChainVerification, error) {
+	var v ChainVerification
+	var links []chainLink
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return v, err
+		}
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			if link, ok := readChainLink(line, data, &v); ok {
+				links = append(links, link)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].sequence < links[j].sequence
+	})
+
+	for i, link := range links {
+		v.Events++
+
+		if i == 0 {
+			v.Head = HashChainHead{Sequence: link.sequence, Hash: link.hash}
+			continue
+		}
+
+		prev := links[i-1]
+		switch {
+		case link.sequence == prev.sequence:
+			v.Breaks = append(v.Breaks, ChainBreak{Line: link.line, Sequence: link.sequence, Reason: ChainDuplicate})
+			continue
+		case link.sequence > prev.sequence+1:
+			v.Breaks = append(v.Breaks, ChainBreak{
+				Line:     link.line,
+				Sequence: link.sequence,
+				Reason:   ChainGap,
+				Missing:  link.sequence - prev.sequence - 1,
+			})
+		case link.previous != prev.hash:
+			v.Breaks = append(v.Breaks, ChainBreak{Line: link.line, Sequence: link.sequence, Reason: ChainModified})
+		}
+
+		v.Head = HashChainHead{Sequence: link.sequence, Hash: link.hash}
+	}
+
+	sort.SliceStable(v.Breaks, func(i, j int) bool {
+		return v.Breaks[i].Line < v.Breaks[j].Line
+	})
+
+	return v, nil
+}
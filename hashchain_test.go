@@ -0,0 +1,220 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// linkEvent links the audit event to the chain.
+func linkEvent(t *testing.T, chain *HashChain, aep *AuditEventPayload) *AuditEventPayload {
+	assert.NoError(t, chain.Process(context.Background(), aep))
+	return aep
+}
+
+// chainedLines returns the audit events linked with a new in-memory hash chain
+// encoded as JSON Lines.
+func chainedLines(t *testing.T, events ...AuditEvent) []string {
+	chain, err := NewHashChain("")
+	assert.NoError(t, err)
+
+	var lines []string
+	for _, event := range events {
+		aep := linkEvent(t, chain, NewAuditEventPayload(event))
+		data, err := json.Marshal(aep)
+		assert.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+
+	return lines
+}
+
+func verifyLines(t *testing.T, lines []string) ChainVerification {
+	v, err := VerifyHashChain(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	assert.NoError(t, err)
+
+	return v
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	canonical, err := CanonicalJSON([]byte(`{ "b": [1.50, "<a>", null, true], "a": {"d": 9007199254740993, "c": "é"} }`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":{"c":"é","d":9007199254740993},"b":[1.50,"<a>",null,true]}`, string(canonical))
+}
+
+func TestHashChainLinksAuditEvents(t *testing.T) {
+	chain, err := NewHashChain("")
+	assert.NoError(t, err)
+
+	first := linkEvent(t, chain, NewAuditEventPayload(AuditEvent{"action": "user.login"}))
+	second := linkEvent(t, chain, NewAuditEventPayload(AuditEvent{"action": "user.logout"}))
+
+	assert.Equal(t, uint64(1), first.DotCased.Sequence)
+	assert.Empty(t, first.DotCased.PreviousHash)
+	assert.Equal(t, uint64(2), second.DotCased.Sequence)
+
+	hash, err := hashPayload(first)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, second.DotCased.PreviousHash)
+	assert.Equal(t, uint64(2), chain.Head().Sequence)
+}
+
+func TestHashChainPersistsHead(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "chain", "head.json")
+	chain, err := NewHashChain(path)
+	assert.NoError(t, err)
+	linkEvent(t, chain, NewAuditEventPayload(AuditEvent{"action": "user.login"}))
+	head := chain.Head()
+
+	restarted, err := NewHashChain(path)
+	assert.NoError(t, err)
+	assert.Equal(t, head, restarted.Head())
+
+	aep := linkEvent(t, restarted, NewAuditEventPayload(AuditEvent{"action": "user.logout"}))
+	assert.Equal(t, uint64(2), aep.DotCased.Sequence)
+	assert.Equal(t, head.Hash, aep.DotCased.PreviousHash)
+}
+
+func TestHashChainRejectsEventsWhenHeadCannotBeSaved(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	// The head cannot be saved while a directory is in the way of its
+	// temporary file.
+	path := filepath.Join(dir, "head.json")
+	assert.NoError(t, os.Mkdir(path+".tmp", spoolDirPerm))
+	chain, err := NewHashChain(path)
+	assert.NoError(t, err)
+
+	transport := &recordingTransport{}
+	p := NewPublisher(
+		WithTransport(transport),
+		WithProcessors(append(DefaultProcessors(), chain.Process)...),
+	)
+
+	assert.Error(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.Empty(t, transport.actions())
+	assert.Equal(t, HashChainHead{}, chain.Head())
+}
+
+func TestNewHashChainRejectsInvalidHead(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "head.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), spoolFilePerm))
+
+	_, err := NewHashChain(path)
+	assert.Error(t, err)
+}
+
+func TestVerifyHashChain(t *testing.T) {
+	lines := chainedLines(t,
+		AuditEvent{"action": "user.login", "count": int64(9007199254740993)},
+		AuditEvent{"action": "user.update", "email": NewSensitiveValue("user@example.com", "email")},
+		AuditEvent{"action": "user.logout", "html": "<b>&</b>"},
+	)
+
+	v := verifyLines(t, lines)
+
+	assert.True(t, v.Valid(), v.Breaks)
+	assert.Equal(t, 3, v.Events)
+	assert.Equal(t, uint64(3), v.Head.Sequence)
+}
+
+func TestVerifyHashChainOutOfOrder(t *testing.T) {
+	lines := chainedLines(t, AuditEvent{"action": "a"}, AuditEvent{"action": "b"}, AuditEvent{"action": "c"})
+
+	v := verifyLines(t, []string{lines[1], lines[0], lines[2]})
+
+	assert.True(t, v.Valid(), v.Breaks)
+	assert.Equal(t, uint64(3), v.Head.Sequence)
+}
+
+func TestVerifyHashChainReportsGaps(t *testing.T) {
+	lines := chainedLines(t, AuditEvent{"action": "a"}, AuditEvent{"action": "b"}, AuditEvent{"action": "c"}, AuditEvent{"action": "d"})
+
+	v := verifyLines(t, []string{lines[0], lines[3]})
+
+	assert.Equal(t, []ChainBreak{{Line: 2, Sequence: 4, Reason: ChainGap, Missing: 2}}, v.Breaks)
+	assert.Equal(t, "line 2: 2 audit events missing before sequence 4", v.Breaks[0].String())
+}
+
+func TestVerifyHashChainReportsModifications(t *testing.T) {
+	lines := chainedLines(t, AuditEvent{"action": "a"}, AuditEvent{"action": "b"}, AuditEvent{"action": "c"})
+	lines[1] = strings.Replace(lines[1], `"action":"b"`, `"action":"x"`, 1)
+
+	v := verifyLines(t, lines)
+
+	assert.Equal(t, []ChainBreak{{Line: 3, Sequence: 3, Reason: ChainModified}}, v.Breaks)
+}
+
+func TestVerifyHashChainReportsModifiedHead(t *testing.T) {
+	chain, err := NewHashChain("")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	for _, action := range []string{"a", "b"} {
+		data, err := json.Marshal(linkEvent(t, chain, NewAuditEventPayload(AuditEvent{"action": action})))
+		assert.NoError(t, err)
+		buf.Write(append(data, '\n'))
+	}
+
+	modified := strings.Replace(buf.String(), `"action":"b"`, `"action":"x"`, 1)
+	v, err := VerifyHashChain(strings.NewReader(modified))
+
+	assert.NoError(t, err)
+	assert.True(t, v.Valid())
+	assert.NotEqual(t, chain.Head(), v.Head)
+}
+
+func TestVerifyHashChainReportsInvalidLines(t *testing.T) {
+	lines := chainedLines(t, AuditEvent{"action": "a"}, AuditEvent{"action": "b"})
+
+	v := verifyLines(t, []string{lines[0], lines[0], "{", `{"action":"c"}`, lines[1]})
+
+	assert.Equal(t, []ChainBreak{
+		{Line: 2, Sequence: 1, Reason: ChainDuplicate},
+		{Line: 3, Reason: ChainMalformed},
+		{Line: 4, Reason: ChainUnlinked},
+	}, v.Breaks)
+	assert.Equal(t, 3, v.Events)
+}
+
+func TestHashChainWithFileTransport(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	chain, err := NewHashChain(filepath.Join(dir, "head.json"))
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	p := NewPublisher(
+		WithTransport(NewFileTransport(path)),
+		WithProcessors(append(DefaultProcessors(), chain.Process)...),
+	)
+	for _, action := range []string{"user.login", "user.update", "user.logout"} {
+		assert.NoError(t, p.Publish(AuditEvent{"action": action, "user": NewSensitiveValue("user@example.com", "email")}))
+	}
+	assert.NoError(t, p.Close(context.Background()))
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	v, err := VerifyHashChain(f)
+	assert.NoError(t, err)
+	assert.True(t, v.Valid(), v.Breaks)
+	assert.Equal(t, chain.Head(), v.Head)
+}
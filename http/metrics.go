@@ -0,0 +1,81 @@
+package casedhttp
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/cased/cased-go"
+)
+
+// MetricsHandler exposes the publisher metrics in the Prometheus text format.
+func MetricsHandler(metrics *cased.MemoryMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, metrics.Snapshot())
+		_ = bw.Flush()
+	})
+}
+
+func writeMetrics(w *bufio.Writer, s cased.MetricsSnapshot) {
+	writeHeader(w, "cased_events_published_total", "counter", "Audit events published to Cased.")
+	fmt.Fprintf(w, "cased_events_published_total %d\n", s.Published)
+
+	writeHeader(w, "cased_events_failed_total", "counter", "Audit events that could not be published by the status of their last attempt.")
+	for _, status := range statuses(s.Failed) {
+		fmt.Fprintf(w, "cased_events_failed_total{status=\"%d\"} %d\n", status, s.Failed[status])
+	}
+
+	writeHeader(w, "cased_events_dropped_total", "counter", "Audit events dropped because the buffer was full.")
+	fmt.Fprintf(w, "cased_events_dropped_total %d\n", s.Dropped)
+
+	writeHeader(w, "cased_publish_retries_total", "counter", "Failed requests to publish audit events that were retried.")
+	fmt.Fprintf(w, "cased_publish_retries_total %d\n", s.Retries)
+
+	writeHeader(w, "cased_publish_requests_total", "counter", "Requests made to publish audit events by response status.")
+	for _, status := range statuses(s.Requests) {
+		fmt.Fprintf(w, "cased_publish_requests_total{status=\"%d\"} %d\n", status, s.Requests[status])
+	}
+
+	writeHeader(w, "cased_publish_request_duration_seconds", "histogram", "Latency of requests made to publish audit events.")
+	for i, le := range s.Latency.Buckets {
+		fmt.Fprintf(w, "cased_publish_request_duration_seconds_bucket{le=\"%s\"} %d\n", formatFloat(le), s.Latency.Counts[i])
+	}
+	fmt.Fprintf(w, "cased_publish_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.Latency.Count)
+	fmt.Fprintf(w, "cased_publish_request_duration_seconds_sum %s\n", formatFloat(s.Latency.Sum))
+	fmt.Fprintf(w, "cased_publish_request_duration_seconds_count %d\n", s.Latency.Count)
+
+	writeHeader(w, "cased_queue_depth", "gauge", "Audit events waiting to be published.")
+	fmt.Fprintf(w, "cased_queue_depth %d\n", s.QueueDepth)
+
+	writeHeader(w, "cased_circuit_breaker_state", "gauge", "State of the circuit breaker, 0 is closed, 1 is open and 2 is half-open.")
+	fmt.Fprintf(w, "cased_circuit_breaker_state %d\n", s.CircuitState)
+
+	writeHeader(w, "cased_circuit_breaker_opened_total", "counter", "Times the circuit breaker opened.")
+	fmt.Fprintf(w, "cased_circuit_breaker_opened_total %d\n", s.CircuitOpened)
+}
+
+func writeHeader(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// statuses returns the statuses of the counts in ascending order so the output
+// is stable.
+func statuses(counts map[int]uint64) []int {
+	keys := make([]int, 0, len(counts))
+	for status := range counts {
+		keys = append(keys, status)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
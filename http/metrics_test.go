@@ -0,0 +1,50 @@
+package casedhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cased/cased-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	m := cased.NewMemoryMetrics()
+	m.ObserveRequest(http.StatusCreated, 20*time.Millisecond)
+	m.ObserveRequest(http.StatusServiceUnavailable, time.Second)
+	m.ObserveRetry()
+	m.ObserveDelivery(cased.DeliveryReport{StatusCode: http.StatusCreated})
+	m.ObserveDelivery(cased.DeliveryReport{Err: cased.ErrQueueFull})
+	m.AddQueueDepth(4)
+	m.ObserveCircuitState(cased.CircuitOpen)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	MetricsHandler(m).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE cased_events_published_total counter",
+		"cased_events_published_total 1",
+		"cased_events_dropped_total 1",
+		"cased_publish_retries_total 1",
+		`cased_publish_requests_total{status="201"} 1`,
+		`cased_publish_requests_total{status="503"} 1`,
+		`cased_publish_request_duration_seconds_bucket{le="0.025"} 1`,
+		`cased_publish_request_duration_seconds_bucket{le="1"} 2`,
+		`cased_publish_request_duration_seconds_bucket{le="+Inf"} 2`,
+		"cased_publish_request_duration_seconds_sum 1.02",
+		"cased_publish_request_duration_seconds_count 2",
+		"# TYPE cased_queue_depth gauge",
+		"cased_queue_depth 4",
+		"cased_circuit_breaker_state 1",
+		"cased_circuit_breaker_opened_total 1",
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
@@ -0,0 +1,86 @@
+package cased
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used to encode event IDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ids = &idGenerator{}
+
+// idGenerator generates monotonic ULIDs. IDs generated within the same
+// millisecond increment the random component of the previous ID so they sort
+// in the order they were generated.
+type idGenerator struct {
+	mu      sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// NewEventID returns a new unique event ID. Event IDs are ULIDs, so they sort
+// lexicographically in the order they were generated.
+func NewEventID() string {
+	return ids.next(time.Now())
+}
+
+func (g *idGenerator) next(now time.Time) string {
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms <= g.ms && g.increment() {
+		ms = g.ms
+	} else {
+		g.ms = ms
+		if _, err := rand.Read(g.entropy[:]); err != nil {
+			// Fall back to the time in the unlikely case the system's secure
+			// random number generator fails.
+			binary.BigEndian.PutUint64(g.entropy[2:], uint64(now.UnixNano()))
+		}
+	}
+
+	var id [16]byte
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+	copy(id[6:], g.entropy[:])
+
+	return encodeULID(id)
+}
+
+// increment increments the random component of the previous ID, returning
+// false if it overflowed.
+func (g *idGenerator) increment() bool {
+	for i := len(g.entropy) - 1; i >= 0; i-- {
+		g.entropy[i]++
+		if g.entropy[i] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeULID encodes the 128 bit ULID as 26 characters of Crockford base32.
+func encodeULID(id [16]byte) string {
+	var dst [26]byte
+
+	// The 130 bits of output encode the 128 bit ID with two leading zero bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		dst[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(dst[:])
+}
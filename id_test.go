@@ -0,0 +1,54 @@
+package cased
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEventID(t *testing.T) {
+	id := NewEventID()
+
+	assert.Len(t, id, 26)
+	for _, c := range id {
+		assert.True(t, strings.ContainsRune(crockford, c), id)
+	}
+}
+
+func TestNewEventIDIsMonotonic(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = NewEventID()
+	}
+
+	assert.True(t, sort.StringsAreSorted(ids))
+
+	unique := map[string]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	assert.Len(t, unique, len(ids))
+}
+
+func TestEventIDEncodesTimestamp(t *testing.T) {
+	g := &idGenerator{}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	earlier := g.next(now)
+	later := g.next(now.Add(time.Millisecond))
+
+	// The first 10 characters encode the 48 bit millisecond timestamp.
+	assert.Equal(t, "01ETXKWW00", earlier[:10])
+	assert.True(t, earlier[:10] < later[:10])
+}
+
+func TestNewAuditEventPayloadAssignsID(t *testing.T) {
+	first := NewAuditEventPayload(AuditEvent{})
+	second := NewAuditEventPayload(AuditEvent{})
+
+	assert.NotEmpty(t, first.DotCased.ID)
+	assert.NotEqual(t, first.DotCased.ID, second.DotCased.ID)
+}
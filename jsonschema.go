@@ -0,0 +1,662 @@
+package cased
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema. The validation keywords of draft 7
+// commonly used to describe audit events are supported: type, enum, const,
+// properties, required, additionalProperties, patternProperties, items,
+// minItems, maxItems, uniqueItems, minLength, maxLength, pattern, format,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf,
+// anyOf, oneOf, not, and $ref to definitions within the same schema.
+type jsonSchema struct {
+	// always is the result of the true and false schemas.
+	always *bool
+
+	ref  string
+	root *schemaRoot
+
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties           map[string]*jsonSchema
+	patternProperties    map[*regexp.Regexp]*jsonSchema
+	additionalProperties *jsonSchema
+	required             []string
+
+	items       *jsonSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*jsonSchema
+	anyOf []*jsonSchema
+	oneOf []*jsonSchema
+	not   *jsonSchema
+}
+
+// schemaRoot is the document a schema was compiled from, used to resolve
+// references.
+type schemaRoot struct {
+	doc  interface{}
+	refs map[string]*jsonSchema
+}
+
+// SchemaViolation is a place where an audit event does not match its schema.
+type SchemaViolation struct {
+	// Path is the path of the invalid value within the audit event, such as
+	// .user.email, or empty for the audit event itself.
+	Path string `json:"path,omitempty"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+func (v SchemaViolation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+
+	return v.Path + ": " + v.Message
+}
+
+// compileSchema compiles the JSON Schema document.
+func compileSchema(data []byte) (*jsonSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	root := &schemaRoot{doc: doc, refs: map[string]*jsonSchema{}}
+	s, err := root.compile(doc)
+	if err != nil {
+		return nil, err
+	}
+	root.refs["#"] = s
+
+	// Resolve every reference up front so invalid references are reported
+	// when the schema is registered.
+	for ref := range collectRefs(doc, nil) {
+		if _, err := root.resolve(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func collectRefs(v interface{}, refs map[string]bool) map[string]bool {
+	if refs == nil {
+		refs = map[string]bool{}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			refs[ref] = true
+		}
+		for _, e := range v {
+			collectRefs(e, refs)
+		}
+	case []interface{}:
+		for _, e := range v {
+			collectRefs(e, refs)
+		}
+	}
+
+	return refs
+}
+
+// resolve returns the compiled schema the local reference points to.
+func (r *schemaRoot) resolve(ref string) (*jsonSchema, error) {
+	if s, ok := r.refs[ref]; ok {
+		return s, nil
+	}
+
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("cased: only references within the schema are supported: %s", ref)
+	}
+
+	doc := r.doc
+	if pointer := strings.TrimPrefix(ref, "#"); pointer != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			if unescaped, err := url.PathUnescape(token); err == nil {
+				token = unescaped
+			}
+
+			switch d := doc.(type) {
+			case map[string]interface{}:
+				doc = d[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(d) {
+					return nil, fmt.Errorf("cased: invalid schema reference %s", ref)
+				}
+				doc = d[i]
+			default:
+				doc = nil
+			}
+
+			if doc == nil {
+				return nil, fmt.Errorf("cased: invalid schema reference %s", ref)
+			}
+		}
+	}
+
+	// Register the schema before compiling it so recursive references resolve
+	// to it.
+	s := &jsonSchema{}
+	r.refs[ref] = s
+	compiled, err := r.compile(doc)
+	if err != nil {
+		return nil, err
+	}
+	*s = *compiled
+
+	return s, nil
+}
+
+func (r *schemaRoot) compile(doc interface{}) (*jsonSchema, error) {
+	if b, ok := doc.(bool); ok {
+		return &jsonSchema{always: &b}, nil
+	}
+
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cased: schema must be an object or boolean, got %T", doc)
+	}
+
+	s := &jsonSchema{root: r}
+	var err error
+
+	if ref, ok := m["$ref"].(string); ok {
+		s.ref = ref
+	}
+
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, e := range t {
+			if name, ok := e.(string); ok {
+				s.types = append(s.types, name)
+			}
+		}
+	}
+
+	if enum, ok := m["enum"].([]interface{}); ok {
+		s.enum = enum
+	}
+	s.constant, s.hasConst = m["const"]
+
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		s.properties = map[string]*jsonSchema{}
+		for name, prop := range props {
+			if s.properties[name], err = r.compile(prop); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if props, ok := m["patternProperties"].(map[string]interface{}); ok {
+		s.patternProperties = map[*regexp.Regexp]*jsonSchema{}
+		for pattern, prop := range props {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if s.patternProperties[re], err = r.compile(prop); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if additional, ok := m["additionalProperties"]; ok {
+		if s.additionalProperties, err = r.compile(additional); err != nil {
+			return nil, err
+		}
+	}
+
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, e := range required {
+			if name, ok := e.(string); ok {
+				s.required = append(s.required, name)
+			}
+		}
+	}
+
+	if items, ok := m["items"]; ok {
+		if s.items, err = r.compile(items); err != nil {
+			return nil, err
+		}
+	}
+
+	s.minItems = schemaInt(m, "minItems")
+	s.maxItems = schemaInt(m, "maxItems")
+	s.uniqueItems, _ = m["uniqueItems"].(bool)
+	s.minLength = schemaInt(m, "minLength")
+	s.maxLength = schemaInt(m, "maxLength")
+
+	if pattern, ok := m["pattern"].(string); ok {
+		if s.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+	s.format, _ = m["format"].(string)
+
+	s.minimum = schemaNumber(m, "minimum")
+	s.maximum = schemaNumber(m, "maximum")
+	s.exclusiveMinimum = schemaNumber(m, "exclusiveMinimum")
+	s.exclusiveMaximum = schemaNumber(m, "exclusiveMaximum")
+	s.multipleOf = schemaNumber(m, "multipleOf")
+
+	for keyword, list := range map[string]*[]*jsonSchema{"allOf": &s.allOf, "anyOf": &s.anyOf, "oneOf": &s.oneOf} {
+		schemas, ok := m[keyword].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, e := range schemas {
+			compiled, err := r.compile(e)
+			if err != nil {
+				return nil, err
+			}
+			*list = append(*list, compiled)
+		}
+	}
+
+	if not, ok := m["not"]; ok {
+		if s.not, err = r.compile(not); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func schemaNumber(m map[string]interface{}, keyword string) *float64 {
+	n, ok := m[keyword].(json.Number)
+	if !ok {
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return nil
+	}
+
+	return &f
+}
+
+func schemaInt(m map[string]interface{}, keyword string) *int {
+	f := schemaNumber(m, keyword)
+	if f == nil {
+		return nil
+	}
+
+	i := int(*f)
+	return &i
+}
+
+// validate returns the violations of the value, decoded from JSON with
+// json.Number numbers, at the path.
+func (s *jsonSchema) validate(path string, v interface{}) []SchemaViolation {
+	if s.always != nil {
+		if *s.always {
+			return nil
+		}
+		return []SchemaViolation{{Path: path, Message: "no value is allowed"}}
+	}
+
+	if s.ref != "" {
+		ref, err := s.root.resolve(s.ref)
+		if err != nil {
+			return []SchemaViolation{{Path: path, Message: err.Error()}}
+		}
+		// Keywords next to $ref are ignored in draft 7.
+		return ref.validate(path, v)
+	}
+
+	var violations []SchemaViolation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !matchesType(s.types, v) {
+		fail("expected %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+		return violations
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", encodeJSONValues(s.enum...))
+		}
+	}
+
+	if s.hasConst && !jsonEqual(s.constant, v) {
+		fail("must be %s", encodeJSONValues(s.constant))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		violations = append(violations, s.validateObject(path, v)...)
+	case []interface{}:
+		violations = append(violations, s.validateArray(path, v)...)
+	case string:
+		violations = append(violations, s.validateString(path, v)...)
+	case json.Number:
+		violations = append(violations, s.validateNumber(path, v)...)
+	}
+
+	for _, sub := range s.allOf {
+		violations = append(violations, sub.validate(path, v)...)
+	}
+
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if len(sub.validate(path, v)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must match at least one schema in anyOf")
+		}
+	}
+
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if len(sub.validate(path, v)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", matched)
+		}
+	}
+
+	if s.not != nil && len(s.not.validate(path, v)) == 0 {
+		fail("must not match schema in not")
+	}
+
+	return violations
+}
+
+func (s *jsonSchema) validateObject(path string, m map[string]interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+
+	for _, name := range s.required {
+		if _, ok := m[name]; !ok {
+			violations = append(violations, SchemaViolation{Path: pathKey(path, name), Message: "is required"})
+		}
+	}
+
+	for _, key := range sortedKeys(m) {
+		matched := false
+
+		if prop, ok := s.properties[key]; ok {
+			matched = true
+			violations = append(violations, prop.validate(pathKey(path, key), m[key])...)
+		}
+
+		for re, prop := range s.patternProperties {
+			if re.MatchString(key) {
+				matched = true
+				violations = append(violations, prop.validate(pathKey(path, key), m[key])...)
+			}
+		}
+
+		if !matched && s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				violations = append(violations, SchemaViolation{Path: pathKey(path, key), Message: "is not allowed"})
+				continue
+			}
+			violations = append(violations, s.additionalProperties.validate(pathKey(path, key), m[key])...)
+		}
+	}
+
+	return violations
+}
+
+func (s *jsonSchema) validateArray(path string, a []interface{}) []SchemaViolation {
+	var violations []SchemaViolation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.minItems != nil && len(a) < *s.minItems {
+		fail("must have at least %d items", *s.minItems)
+	}
+
+	if s.maxItems != nil && len(a) > *s.maxItems {
+		fail("must have at most %d items", *s.maxItems)
+	}
+
+	if s.uniqueItems {
+	unique:
+		for i := range a {
+			for j := i + 1; j < len(a); j++ {
+				if jsonEqual(a[i], a[j]) {
+					fail("items must be unique")
+					break unique
+				}
+			}
+		}
+	}
+
+	if s.items != nil {
+		for i, e := range a {
+			violations = append(violations, s.items.validate(fmt.Sprintf("%s[%d]", path, i), e)...)
+		}
+	}
+
+	return violations
+}
+
+func (s *jsonSchema) validateString(path, str string) []SchemaViolation {
+	var violations []SchemaViolation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		fail("must be at least %d characters", *s.minLength)
+	}
+
+	if s.maxLength != nil && length > *s.maxLength {
+		fail("must be at most %d characters", *s.maxLength)
+	}
+
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		fail("must match pattern %s", s.pattern)
+	}
+
+	if s.format != "" && !validFormat(s.format, str) {
+		fail("must be a valid %s", s.format)
+	}
+
+	return violations
+}
+
+func (s *jsonSchema) validateNumber(path string, n json.Number) []SchemaViolation {
+	var violations []SchemaViolation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		fail("invalid number %s", n)
+		return violations
+	}
+
+	if s.minimum != nil && f < *s.minimum {
+		fail("must be at least %v", *s.minimum)
+	}
+
+	if s.maximum != nil && f > *s.maximum {
+		fail("must be at most %v", *s.maximum)
+	}
+
+	if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+		fail("must be greater than %v", *s.exclusiveMinimum)
+	}
+
+	if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+		fail("must be less than %v", *s.exclusiveMaximum)
+	}
+
+	if s.multipleOf != nil && *s.multipleOf > 0 {
+		if q := f / *s.multipleOf; q != math.Trunc(q) {
+			fail("must be a multiple of %v", *s.multipleOf)
+		}
+	}
+
+	return violations
+}
+
+func matchesType(types []string, v interface{}) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonType returns the JSON Schema type of the value, integer for numbers
+// without a fractional part.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// jsonEqual reports whether the decoded JSON values are equal, comparing
+// numbers by value.
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeNumbers(a), normalizeNumbers(b))
+}
+
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = normalizeNumbers(e)
+		}
+		return s
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			m[key] = normalizeNumbers(e)
+		}
+		return m
+	default:
+		return v
+	}
+}
+
+func encodeJSONValues(values ...interface{}) string {
+	encoded := make([]string, len(values))
+	for i, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte(fmt.Sprint(v))
+		}
+		encoded[i] = string(b)
+	}
+
+	return strings.Join(encoded, ", ")
+}
+
+// validFormat reports whether the string is valid for the format. Unknown
+// formats are not validated.
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "email":
+		return isEmailAddress(s)
+	case "ipv4":
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	case "ipv6":
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidPattern.MatchString(s)
+	default:
+		return true
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
@@ -0,0 +1,384 @@
+package cased
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnsupportedTypeError is returned by MarshalAuditEvent when a value cannot be
+// represented in an audit event.
+type UnsupportedTypeError struct {
+	// Field is the path of the value within the audit event, such as .user.id,
+	// or empty for the value being marshalled.
+	Field string
+	Type  reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("cased: cannot marshal %s into an audit event", e.Type)
+	}
+
+	return fmt.Sprintf("cased: cannot marshal %s at %s into an audit event", e.Type, e.Field)
+}
+
+// MarshalAuditEvent returns the audit event of the struct or pointer to a
+// struct. Each exported field is a field of the audit event, configured with
+// the cased struct tag:
+//
+//	type Login struct {
+//		Action    string    `cased:"action"`
+//		Email     string    `cased:"actor,sensitive=email"`
+//		Location  string    `cased:"location,omitempty,sensitive=ip-address"`
+//		Timestamp time.Time `cased:"timestamp,omitempty"`
+//		Password  string    `cased:"-"`
+//	}
+//
+// The tag's name is the field's name in the audit event, defaulting to the name
+// in the json struct tag and then the Go field name. The field is skipped if
+// the name is "-". The omitempty option omits the field if it has its zero
+// value, and the sensitive option marks the field's value, or each of its
+// values for slices, as a SensitiveValue with the label.
+//
+// Nested structs and maps become nested objects, and slices and arrays become
+// lists. Pointers and interfaces are marshalled as the value they point to, or
+// nil. The fields of embedded structs without a name are promoted to the
+// enclosing struct. Values of types implementing fmt.Stringer are marshalled
+// as their string, except time.Time which is kept as is, including through a
+// *time.Time. Channels, functions and complex numbers cannot be marshalled.
+func MarshalAuditEvent(v interface{}) (AuditEvent, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct || rv.Type() == timeType {
+		return nil, &UnsupportedTypeError{Type: reflect.TypeOf(v)}
+	}
+
+	e := &eventEncoder{seen: map[uintptr]bool{}}
+	m, err := e.encodeStruct("", rv)
+	if err != nil {
+		return nil, err
+	}
+
+	return AuditEvent(m), nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// eventEncoder encodes Go values into audit event values, detecting pointer
+// cycles.
+type eventEncoder struct {
+	seen map[uintptr]bool
+}
+
+func (e *eventEncoder) encodeStruct(path string, v reflect.Value) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+
+	for _, f := range cachedStructFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		fieldPath := pathKey(path, f.name)
+		value, err := e.encode(fieldPath, fv)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.sensitive != "" {
+			if value, err = sensitiveFieldValue(fieldPath, value, f.sensitive); err != nil {
+				return nil, err
+			}
+		}
+
+		m[f.name] = value
+	}
+
+	return m, nil
+}
+
+func (e *eventEncoder) encode(path string, v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	// Pointers are followed before looking for fmt.Stringer so values such as
+	// *time.Time are marshalled as the value they point to.
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		ptr := v.Pointer()
+		if e.seen[ptr] {
+			return nil, fmt.Errorf("cased: cannot marshal cycle at %s into an audit event", path)
+		}
+		e.seen[ptr] = true
+		defer delete(e.seen, ptr)
+
+		return e.encode(path, v.Elem())
+	}
+
+	switch v.Type() {
+	case timeType:
+		return v.Interface(), nil
+	case sensitiveValueType:
+		return snapshotSensitiveValue(v.Interface().(SensitiveValue)), nil
+	case bytesType:
+		return append([]byte(nil), v.Bytes()...), nil
+	}
+
+	if s, ok := stringer(v); ok {
+		return s.String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return e.encode(path, v.Elem())
+	case reflect.Struct:
+		return e.encodeStruct(path, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			value, err := e.encode(pathKey(path, key), iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			value, err := e.encode(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = value
+		}
+		return s, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+
+	return nil, &UnsupportedTypeError{Field: path, Type: v.Type()}
+}
+
+// stringer returns the value as a fmt.Stringer if it or a pointer to it
+// implements fmt.Stringer.
+func stringer(v reflect.Value) (fmt.Stringer, bool) {
+	if v.Kind() == reflect.Interface {
+		return nil, false
+	}
+
+	if v.Type().Implements(stringerType) {
+		s, ok := v.Interface().(fmt.Stringer)
+		return s, ok
+	}
+
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(stringerType) {
+		s, ok := v.Addr().Interface().(fmt.Stringer)
+		return s, ok
+	}
+
+	return nil, false
+}
+
+// sensitiveFieldValue marks the encoded value, or each of the values in a
+// list, as sensitive with the label.
+func sensitiveFieldValue(path string, value interface{}, label string) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case SensitiveValue:
+		return v, nil
+	case string:
+		return NewSensitiveValue(v, label), nil
+	case bool, int64, uint64, float64:
+		return NewSensitiveValue(fmt.Sprint(v), label), nil
+	case time.Time:
+		return NewSensitiveValue(v.Format(time.RFC3339Nano), label), nil
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			sv, err := sensitiveFieldValue(fmt.Sprintf("%s[%d]", path, i), e, label)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = sv
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("cased: cannot mark %T at %s as sensitive", value, path)
+}
+
+// structField is an exported field of a struct marshalled into an audit
+// event.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	sensitive string
+}
+
+var structFieldCache sync.Map // map[reflect.Type][]structField
+
+func cachedStructFields(t reflect.Type) []structField {
+	if fields, ok := structFieldCache.Load(t); ok {
+		return fields.([]structField)
+	}
+
+	fields, _ := structFieldCache.LoadOrStore(t, structFields(t, nil))
+	return fields.([]structField)
+}
+
+// structFields returns the fields of the struct type, including the fields of
+// embedded structs without a name. Fields of the outer struct take precedence
+// over promoted fields with the same name.
+func structFields(t reflect.Type, index []int) []structField {
+	var fields, promoted []structField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		tag, hasTag := sf.Tag.Lookup("cased")
+		name, opts := parseCasedTag(tag)
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if !hasTag {
+			if jsonName, _ := parseCasedTag(sf.Tag.Get("json")); jsonName == "-" {
+				continue
+			} else {
+				name = jsonName
+			}
+		}
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				promoted = append(promoted, structFields(ft, fieldIndex)...)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := structField{name: name, index: fieldIndex}
+		for _, opt := range strings.Split(opts, ",") {
+			switch {
+			case opt == "omitempty":
+				f.omitEmpty = true
+			case opt == "sensitive":
+				f.sensitive = DefaultSensitiveLabel
+			case strings.HasPrefix(opt, "sensitive="):
+				f.sensitive = strings.TrimPrefix(opt, "sensitive=")
+			}
+		}
+
+		fields = append(fields, f)
+	}
+
+	names := map[string]bool{}
+	for _, f := range fields {
+		names[f.name] = true
+	}
+	for _, f := range promoted {
+		if !names[f.name] {
+			names[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+func parseCasedTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+
+	return tag, ""
+}
+
+// fieldByIndex returns the nested field, or false if it is promoted from a nil
+// embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+
+	return false
+}
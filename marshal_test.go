@@ -0,0 +1,169 @@
+package cased
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRole int
+
+func (r testRole) String() string {
+	switch r {
+	case 1:
+		return "admin"
+	default:
+		return "member"
+	}
+}
+
+type testUser struct {
+	ID     int      `cased:"id"`
+	Email  string   `cased:"email,sensitive=email"`
+	Name   *string  `cased:"name,omitempty,sensitive"`
+	Role   testRole `cased:"role"`
+	Groups []string `cased:"groups,omitempty"`
+	secret string
+}
+
+type testAuditable struct {
+	Timestamp time.Time  `cased:"timestamp,omitempty"`
+	ExpiresAt *time.Time `cased:"expires_at,omitempty"`
+	RequestID string     `json:"request_id"`
+}
+
+type testLogin struct {
+	testAuditable
+	Action    string            `cased:"action"`
+	User      *testUser         `cased:"user"`
+	Location  string            `cased:"location,sensitive=ip-address"`
+	Addresses []string          `cased:"addresses,sensitive=ip-address"`
+	Previous  []testUser        `cased:"previous,omitempty"`
+	Headers   map[string]string `cased:"headers,omitempty"`
+	Extra     interface{}       `cased:"extra"`
+	Attempts  uint8
+	Password  string `cased:"-"`
+	Token     string `json:"-"`
+}
+
+func TestMarshalAuditEvent(t *testing.T) {
+	name := "Jane"
+	at := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	event, err := MarshalAuditEvent(&testLogin{
+		testAuditable: testAuditable{Timestamp: at, ExpiresAt: &at, RequestID: "req_1"},
+		Action:        "user.login",
+		User:          &testUser{ID: 1, Email: "jane@example.com", Name: &name, Role: 1, secret: "s3cr3t"},
+		Location:      "1.1.1.1",
+		Addresses:     []string{"1.1.1.1", "2.2.2.2"},
+		Headers:       map[string]string{"user_agent": "cased-go"},
+		Extra:         testUser{ID: 2},
+		Attempts:      3,
+		Password:      "hunter2",
+		Token:         "token",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, AuditEvent{
+		"timestamp":  at,
+		"expires_at": at,
+		"request_id": "req_1",
+		"action":     "user.login",
+		"user": map[string]interface{}{
+			"id":    int64(1),
+			"email": NewSensitiveValue("jane@example.com", "email"),
+			"name":  NewSensitiveValue("Jane", DefaultSensitiveLabel),
+			"role":  "admin",
+		},
+		"location": NewSensitiveValue("1.1.1.1", "ip-address"),
+		"addresses": []interface{}{
+			NewSensitiveValue("1.1.1.1", "ip-address"),
+			NewSensitiveValue("2.2.2.2", "ip-address"),
+		},
+		"headers": map[string]interface{}{"user_agent": "cased-go"},
+		"extra": map[string]interface{}{
+			"id":    int64(2),
+			"email": NewSensitiveValue("", "email"),
+			"role":  "member",
+		},
+		"Attempts": uint64(3),
+	}, event)
+}
+
+func TestMarshalAuditEventOmitEmpty(t *testing.T) {
+	event, err := MarshalAuditEvent(testLogin{Action: "user.login"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, AuditEvent{
+		"request_id": "",
+		"action":     "user.login",
+		"user":       nil,
+		"location":   NewSensitiveValue("", "ip-address"),
+		"addresses":  nil,
+		"extra":      nil,
+		"Attempts":   uint64(0),
+	}, event)
+}
+
+func TestMarshalAuditEventSensitiveData(t *testing.T) {
+	event, err := MarshalAuditEvent(testLogin{
+		Action: "user.login",
+		User:   &testUser{Email: "jane@example.com"},
+	})
+	assert.NoError(t, err)
+
+	aep := NewAuditEventPayload(event)
+	assert.Equal(t, []*SensitiveRange{{Begin: 0, End: 16, Label: "email"}}, aep.DotCased.PII[".user.email"])
+}
+
+func TestMarshalAuditEventErrors(t *testing.T) {
+	var ute *UnsupportedTypeError
+
+	_, err := MarshalAuditEvent(map[string]interface{}{"action": "user.login"})
+	if assert.True(t, errors.As(err, &ute)) {
+		assert.Equal(t, "", ute.Field)
+	}
+
+	_, err = MarshalAuditEvent((*testLogin)(nil))
+	assert.True(t, errors.As(err, &ute))
+
+	_, err = MarshalAuditEvent(struct {
+		Callbacks []func() `cased:"callbacks"`
+	}{Callbacks: []func(){func() {}}})
+	if assert.True(t, errors.As(err, &ute)) {
+		assert.Equal(t, ".callbacks[0]", ute.Field)
+		assert.Equal(t, reflect.TypeOf(func() {}), ute.Type)
+	}
+
+	_, err = MarshalAuditEvent(struct {
+		User testUser `cased:"user,sensitive"`
+	}{})
+	assert.EqualError(t, err, "cased: cannot mark map[string]interface {} at .user as sensitive")
+
+	type node struct {
+		Next *node `cased:"next"`
+	}
+	n := &node{}
+	n.Next = n
+	_, err = MarshalAuditEvent(n)
+	assert.Error(t, err)
+}
+
+func BenchmarkMarshalAuditEvent(b *testing.B) {
+	login := &testLogin{
+		Action:    "user.login",
+		User:      &testUser{ID: 1, Email: "jane@example.com", Groups: []string{"engineering"}},
+		Location:  "1.1.1.1",
+		Addresses: []string{"1.1.1.1"},
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalAuditEvent(login); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
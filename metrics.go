@@ -0,0 +1,258 @@
+package cased
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Metrics records the health of publishing audit events. Implementations must
+// be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after each request made to publish audit events
+	// with the response status, zero if the request could not be completed,
+	// and how long the request took.
+	ObserveRequest(status int, latency time.Duration)
+
+	// ObserveRetry is called each time a failed request is retried.
+	ObserveRetry()
+
+	// ObserveDelivery is called with the outcome of each published audit
+	// event.
+	ObserveDelivery(report DeliveryReport)
+
+	// AddQueueDepth is called with the change in the number of audit events
+	// waiting to be published.
+	AddQueueDepth(delta int)
+
+	// ObserveCircuitState is called each time the circuit breaker changes
+	// state.
+	ObserveCircuitState(state CircuitState)
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request
+// latency histogram kept by MemoryMetrics.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MemoryMetrics keeps metrics in memory. It implements expvar.Var so it can be
+// exposed with expvar.Publish, and casedhttp.MetricsHandler exposes it in the
+// Prometheus text format.
+type MemoryMetrics struct {
+	mu         sync.Mutex
+	published  uint64
+	failed     map[int]uint64
+	dropped    uint64
+	retries    uint64
+	requests   map[int]uint64
+	buckets    []float64
+	counts     []uint64
+	latencySum time.Duration
+	queueDepth int64
+
+	circuitState  CircuitState
+	circuitOpened uint64
+}
+
+// NewMemoryMetrics returns metrics kept in memory.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		failed:   map[int]uint64{},
+		requests: map[int]uint64{},
+		buckets:  DefaultLatencyBuckets,
+		counts:   make([]uint64, len(DefaultLatencyBuckets)),
+	}
+}
+
+// ObserveRequest counts the request by status and records its latency.
+func (m *MemoryMetrics) ObserveRequest(status int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[status]++
+	m.latencySum += latency
+
+	seconds := latency.Seconds()
+	for i, le := range m.buckets {
+		if seconds <= le {
+			m.counts[i]++
+		}
+	}
+}
+
+// ObserveRetry counts the retried request.
+func (m *MemoryMetrics) ObserveRetry() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retries++
+}
+
+// ObserveDelivery counts the audit event as published, dropped, or failed by
+// the status of its last attempt.
+func (m *MemoryMetrics) ObserveDelivery(report DeliveryReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case report.Err == nil:
+		m.published++
+	case errors.Is(report.Err, ErrQueueFull):
+		m.dropped++
+	default:
+		m.failed[report.StatusCode]++
+	}
+}
+
+// AddQueueDepth adjusts the number of audit events waiting to be published.
+func (m *MemoryMetrics) AddQueueDepth(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.queueDepth += int64(delta)
+}
+
+// ObserveCircuitState records the state of the circuit breaker and counts the
+// times it opened.
+func (m *MemoryMetrics) ObserveCircuitState(state CircuitState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.circuitState = state
+	if state == CircuitOpen {
+		m.circuitOpened++
+	}
+}
+
+// MetricsSnapshot is a point in time copy of MemoryMetrics.
+type MetricsSnapshot struct {
+	// Published is the number of audit events published.
+	Published uint64 `json:"published"`
+
+	// Failed is the number of audit events that could not be published by the
+	// status of their last attempt, zero if no response was received.
+	Failed map[int]uint64 `json:"failed"`
+
+	// Dropped is the number of audit events dropped because the buffer was
+	// full.
+	Dropped uint64 `json:"dropped"`
+
+	// Retries is the number of failed requests that were retried.
+	Retries uint64 `json:"retries"`
+
+	// Requests is the number of requests made by response status, zero if the
+	// request could not be completed.
+	Requests map[int]uint64 `json:"requests"`
+
+	// Latency is the histogram of request latencies.
+	Latency LatencyHistogram `json:"latency"`
+
+	// QueueDepth is the number of audit events waiting to be published.
+	QueueDepth int64 `json:"queue_depth"`
+
+	// CircuitState is the last state the circuit breaker changed to.
+	CircuitState CircuitState `json:"circuit_state"`
+
+	// CircuitOpened is the number of times the circuit breaker opened.
+	CircuitOpened uint64 `json:"circuit_opened"`
+}
+
+// LatencyHistogram is a histogram of request latencies.
+type LatencyHistogram struct {
+	// Buckets are the upper bounds of each bucket in seconds.
+	Buckets []float64 `json:"buckets"`
+
+	// Counts are the cumulative number of requests that completed within each
+	// bucket's upper bound.
+	Counts []uint64 `json:"counts"`
+
+	// Count is the total number of requests observed.
+	Count uint64 `json:"count"`
+
+	// Sum is the total latency of all requests observed in seconds.
+	Sum float64 `json:"sum"`
+}
+
+// Snapshot returns a copy of the current metrics.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := MetricsSnapshot{
+		Published: m.published,
+		Failed:    make(map[int]uint64, len(m.failed)),
+		Dropped:   m.dropped,
+		Retries:   m.retries,
+		Requests:  make(map[int]uint64, len(m.requests)),
+		Latency: LatencyHistogram{
+			Buckets: append([]float64(nil), m.buckets...),
+			Counts:  append([]uint64(nil), m.counts...),
+			Sum:     m.latencySum.Seconds(),
+		},
+		QueueDepth:    m.queueDepth,
+		CircuitState:  m.circuitState,
+		CircuitOpened: m.circuitOpened,
+	}
+
+	for status, n := range m.failed {
+		snapshot.Failed[status] = n
+	}
+	for status, n := range m.requests {
+		snapshot.Requests[status] = n
+		snapshot.Latency.Count += n
+	}
+
+	return snapshot
+}
+
+// String returns the metrics encoded as JSON, implementing expvar.Var.
+func (m *MemoryMetrics) String() string {
+	b, err := json.Marshal(m.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+
+	return string(b)
+}
+
+// noopMetrics discards all metrics, used when no metrics are configured.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(_ int, _ time.Duration) {}
+func (noopMetrics) ObserveRetry()                         {}
+func (noopMetrics) ObserveDelivery(_ DeliveryReport)      {}
+func (noopMetrics) AddQueueDepth(_ int)                   {}
+func (noopMetrics) ObserveCircuitState(_ CircuitState)    {}
+
+func metrics(options PublisherOptions) Metrics {
+	if options.Metrics != nil {
+		return options.Metrics
+	}
+
+	return noopMetrics{}
+}
+
+// observeDeliveries wraps the delivery hooks so the outcome of each audit event
+// is recorded by the configured metrics.
+func observeDeliveries(options PublisherOptions) PublisherOptions {
+	if options.Metrics == nil {
+		return options
+	}
+
+	m, onDelivered, onFailed := options.Metrics, options.OnDelivered, options.OnFailed
+
+	options.OnDelivered = func(report DeliveryReport) {
+		m.ObserveDelivery(report)
+		if onDelivered != nil {
+			onDelivered(report)
+		}
+	}
+	options.OnFailed = func(report DeliveryReport) {
+		m.ObserveDelivery(report)
+		if onFailed != nil {
+			onFailed(report)
+		}
+	}
+
+	return options
+}
@@ -0,0 +1,99 @@
+package cased
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsRecordPublishedEvents(t *testing.T) {
+	ps := newPublishServer(t)
+	m := NewMemoryMetrics()
+	p, restore := newTestPublisher(ps, WithMetrics(m), WithMaxBatchSize(1))
+	defer restore()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(3), s.Published)
+	assert.Equal(t, map[int]uint64{http.StatusCreated: 3}, s.Requests)
+	assert.Equal(t, uint64(3), s.Latency.Count)
+	assert.Equal(t, uint64(3), s.Latency.Counts[len(s.Latency.Counts)-1])
+	assert.Equal(t, int64(0), s.QueueDepth)
+	assert.Empty(t, s.Failed)
+}
+
+func TestMetricsRecordRetriesAndFailures(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 2
+	ps.failStatus = http.StatusServiceUnavailable
+	m := NewMemoryMetrics()
+	p, restore := newTestPublisher(ps, WithMetrics(m), WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(0), s.Published)
+	assert.Equal(t, uint64(1), s.Retries)
+	assert.Equal(t, map[int]uint64{http.StatusServiceUnavailable: 1}, s.Failed)
+	assert.Equal(t, map[int]uint64{http.StatusServiceUnavailable: 2}, s.Requests)
+}
+
+func TestMetricsRecordDroppedEventsAndQueueDepth(t *testing.T) {
+	m := NewMemoryMetrics()
+	ps, p, restore := newOverflowTestPublisher(t, WithMetrics(m), WithOverflowPolicy(OverflowDropNewest))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	assert.Equal(t, ErrQueueFull, p.Publish(AuditEvent{"action": "user.third"}))
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(1), s.Dropped)
+	assert.Equal(t, int64(2), s.QueueDepth)
+
+	close(ps.gate)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, int64(0), m.Snapshot().QueueDepth)
+}
+
+func TestMemoryMetricsLatencyBuckets(t *testing.T) {
+	m := NewMemoryMetrics()
+	m.ObserveRequest(http.StatusCreated, 20*time.Millisecond)
+	m.ObserveRequest(0, 2*time.Second)
+
+	s := m.Snapshot()
+	assert.Equal(t, uint64(2), s.Latency.Count)
+	assert.InDelta(t, 2.02, s.Latency.Sum, 0.0001)
+	for i, le := range s.Latency.Buckets {
+		switch {
+		case le < 0.025:
+			assert.Equal(t, uint64(0), s.Latency.Counts[i], le)
+		case le < 2.5:
+			assert.Equal(t, uint64(1), s.Latency.Counts[i], le)
+		default:
+			assert.Equal(t, uint64(2), s.Latency.Counts[i], le)
+		}
+	}
+}
+
+func TestMemoryMetricsImplementsExpvar(t *testing.T) {
+	m := NewMemoryMetrics()
+	m.ObserveDelivery(DeliveryReport{})
+	m.ObserveDelivery(DeliveryReport{StatusCode: http.StatusBadRequest, Err: errors.New("bad request")})
+
+	var v expvar.Var = m
+	var s MetricsSnapshot
+	assert.NoError(t, json.Unmarshal([]byte(v.String()), &s))
+	assert.Equal(t, uint64(1), s.Published)
+	assert.Equal(t, map[int]uint64{http.StatusBadRequest: 1}, s.Failed)
+}
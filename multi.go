@@ -0,0 +1,459 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Destination is a transport MultiTransport publishes audit events to.
+type Destination struct {
+	// Name identifies the destination in errors and logs. Defaults to the type
+	// of the transport.
+	Name string
+
+	// Transport publishes audit events to the destination.
+	Transport Transporter
+
+	// Required destinations must accept an audit event for Publish to succeed,
+	// and must publish it for the audit event to be reported as delivered.
+	// Audit events are queued for optional destinations without waiting and
+	// failures to publish them are only logged.
+	Required bool
+
+	// QueueSize is the number of audit events queued for the destination before
+	// Publish waits for required destinations or drops audit events for
+	// optional destinations. Defaults to 100.
+	QueueSize int
+}
+
+// DestinationError is returned by MultiTransport when an audit event could not
+// be published to a destination.
+type DestinationError struct {
+	Destination string
+	Err         error
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("cased: could not publish audit event to %s: %v", e.Destination, e.Err)
+}
+
+func (e *DestinationError) Unwrap() error {
+	return e.Err
+}
+
+// MultiTransport publishes each audit event to multiple destinations. Each
+// destination has its own queue so a slow or failing destination does not
+// hold up the others.
+//
+// When any destination is required, Publish returns an error if a required
+// destination did not accept the audit event, and the audit event is reported
+// as delivered once all required destinations published it. When no
+// destination is required, Publish only returns an error if no destination
+// accepted the audit event, and the audit event is reported as delivered once
+// any destination published it.
+type MultiTransport struct {
+	destinations []*multiDestination
+	required     int
+	reporter     reporter
+
+	mu     sync.RWMutex
+	closed bool
+
+	// pending tracks the audit events being published by their ID. The same
+	// audit event can be published more than once at a time.
+	pendingMu sync.Mutex
+	pending   map[string][]*fanout
+
+	start sync.Once
+}
+
+type multiDestination struct {
+	Destination
+
+	queue   chan multiMessage
+	stopped chan struct{}
+}
+
+// multiMessage is an audit event queued for a destination. A message without an
+// event marks the position of a flush in the queue.
+type multiMessage struct {
+	ctx     context.Context
+	event   *AuditEventPayload
+	fanout  *fanout
+	result  chan error
+	flushed chan struct{}
+}
+
+// fanout tracks the outcome of an audit event across destinations until every
+// destination has settled it.
+type fanout struct {
+	id        string
+	settled   []bool
+	required  int
+	remaining int
+	reported  bool
+}
+
+// NewMultiTransport returns a transport that publishes each audit event to all
+// of the destinations.
+func NewMultiTransport(destinations ...Destination) *MultiTransport {
+	t := &MultiTransport{
+		pending: map[string][]*fanout{},
+	}
+
+	for _, d := range destinations {
+		if d.Name == "" {
+			d.Name = fmt.Sprintf("%T", d.Transport)
+		}
+		if d.QueueSize <= 0 {
+			d.QueueSize = defaultBufferSize
+		}
+		if d.Required {
+			t.required++
+		}
+
+		t.destinations = append(t.destinations, &multiDestination{
+			Destination: d,
+			queue:       make(chan multiMessage, d.QueueSize),
+			stopped:     make(chan struct{}),
+		})
+	}
+
+	return t
+}
+
+// Configure configures each destination with the provided options. Audit
+// events are reported by the MultiTransport once their outcome is known rather
+// than by each destination. Destinations that do not report the outcome of
+// audit events settle them once PublishContext returns, see DeliveryReporter.
+func (t *MultiTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+
+	for i, d := range t.destinations {
+		i := i
+		settle := func(report DeliveryReport) {
+			t.settle(i, report)
+		}
+
+		child := options
+		child.OnDelivered, child.OnFailed = settle, settle
+		d.Transport.Configure(child)
+	}
+
+	t.start.Do(func() {
+		for i := range t.destinations {
+			go t.worker(i)
+		}
+	})
+}
+
+func (t *MultiTransport) ReportsDelivery() bool {
+	return true
+}
+
+// Publish publishes the audit event to all destinations.
+func (t *MultiTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext publishes the audit event to all destinations. The context
+// bounds how long PublishContext waits for required destinations, audit events
+// are published to optional destinations independently of the context.
+func (t *MultiTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return ErrClosed
+	}
+
+	f := t.track(event)
+
+	errs := make([]error, len(t.destinations))
+	results := make([]chan error, len(t.destinations))
+	for i, d := range t.destinations {
+		if !d.Required {
+			select {
+			case d.queue <- multiMessage{ctx: context.Background(), event: event, fanout: f}:
+			default:
+				errs[i] = ErrQueueFull
+				t.settleFanout(f, i, DeliveryReport{Event: event, Err: ErrQueueFull})
+			}
+			continue
+		}
+
+		results[i] = make(chan error, 1)
+		select {
+		case d.queue <- multiMessage{ctx: ctx, event: event, fanout: f, result: results[i]}:
+		case <-ctx.Done():
+			results[i] = nil
+			errs[i] = ctx.Err()
+			t.settleFanout(f, i, DeliveryReport{Event: event, Err: ctx.Err()})
+		}
+	}
+	t.mu.RUnlock()
+
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+
+		select {
+		case errs[i] = <-result:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+
+	var first error
+	accepted := false
+	for i, d := range t.destinations {
+		if errs[i] == nil {
+			accepted = true
+			continue
+		}
+
+		// Failures of optional destinations are logged once settled.
+		if first == nil && (d.Required || t.required == 0) {
+			first = &DestinationError{Destination: d.Name, Err: errs[i]}
+		}
+	}
+
+	if t.required == 0 && accepted {
+		return nil
+	}
+
+	return first
+}
+
+// Flush waits for audit events to be published to all destinations.
+func (t *MultiTransport) Flush(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return t.FlushContext(ctx)
+}
+
+// FlushContext waits for audit events to be published to all destinations or
+// until the context is done.
+func (t *MultiTransport) FlushContext(ctx context.Context) bool {
+	flushed := true
+	for _, d := range t.destinations {
+		if !t.drain(ctx, d) || !d.Transport.FlushContext(ctx) {
+			flushed = false
+		}
+	}
+
+	return flushed
+}
+
+// drain waits for the audit events queued for the destination to be handed to
+// its transport.
+func (t *MultiTransport) drain(ctx context.Context, d *multiDestination) bool {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+
+		select {
+		case <-d.stopped:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	flushed := make(chan struct{})
+	select {
+	case d.queue <- multiMessage{flushed: flushed}:
+		t.mu.RUnlock()
+	case <-ctx.Done():
+		t.mu.RUnlock()
+		return false
+	}
+
+	select {
+	case <-flushed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close stops accepting audit events, waits for queued audit events to be
+// handed to each destination and closes the destinations until the context is
+// done. Audit events that could not be published to any destination are
+// reported with a LostEventsError.
+func (t *MultiTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	for _, d := range t.destinations {
+		close(d.queue)
+	}
+	t.mu.Unlock()
+
+	var lost int
+	var first error
+	for _, d := range t.destinations {
+		select {
+		case <-d.stopped:
+		case <-ctx.Done():
+			lost += len(d.queue)
+		}
+
+		if err := d.Transport.Close(ctx); err != nil {
+			var lee *LostEventsError
+			if errors.As(err, &lee) {
+				lost += lee.Lost
+			} else if first == nil {
+				first = &DestinationError{Destination: d.Name, Err: err}
+			}
+		}
+	}
+
+	if lost > 0 {
+		return &LostEventsError{Lost: lost, Err: ctx.Err()}
+	}
+
+	return first
+}
+
+func (t *MultiTransport) worker(i int) {
+	d := t.destinations[i]
+	defer close(d.stopped)
+
+	for m := range d.queue {
+		if m.flushed != nil {
+			close(m.flushed)
+			continue
+		}
+
+		// The audit event is settled for the destination once it fails, or
+		// once it is accepted by a destination that does not report it.
+		err := t.publish(d, m)
+		if err != nil || !reportsDelivery(d.Transport) {
+			t.settleFanout(m.fanout, i, DeliveryReport{Event: m.event, Err: err})
+		}
+
+		if m.result != nil {
+			m.result <- err
+		}
+	}
+}
+
+// publish publishes the audit event to the destination, recovering from panics
+// so one destination cannot take down the others.
+func (t *MultiTransport) publish(d *multiDestination, m multiMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cased: destination %s panicked: %v", d.Name, r)
+		}
+	}()
+
+	return d.Transport.PublishContext(m.ctx, m.event)
+}
+
+// track starts tracking the outcome of the audit event before it is queued for
+// any destination.
+func (t *MultiTransport) track(event *AuditEventPayload) *fanout {
+	f := &fanout{
+		id:        event.DotCased.ID,
+		settled:   make([]bool, len(t.destinations)),
+		required:  t.required,
+		remaining: len(t.destinations),
+	}
+
+	t.pendingMu.Lock()
+	t.pending[f.id] = append(t.pending[f.id], f)
+	t.pendingMu.Unlock()
+
+	return f
+}
+
+// settle records the outcome of publishing the audit event reported by the
+// destination. If the audit event is being published more than once, the
+// outcome is recorded for the oldest publish not yet settled by the
+// destination.
+func (t *MultiTransport) settle(i int, report DeliveryReport) {
+	t.pendingMu.Lock()
+	var f *fanout
+	for _, pending := range t.pending[report.Event.DotCased.ID] {
+		if !pending.settled[i] {
+			f = pending
+			break
+		}
+	}
+	t.pendingMu.Unlock()
+
+	if f != nil {
+		t.settleFanout(f, i, report)
+	}
+}
+
+// settleFanout records the outcome of publishing the audit event to the
+// destination, reporting the audit event once its overall outcome is known.
+// Only the first outcome of each destination is recorded, and the audit event
+// is no longer tracked once every destination settled it.
+func (t *MultiTransport) settleFanout(f *fanout, i int, report DeliveryReport) {
+	d := t.destinations[i]
+
+	t.pendingMu.Lock()
+	if f.settled[i] {
+		t.pendingMu.Unlock()
+		return
+	}
+	f.settled[i] = true
+	f.remaining--
+
+	if f.remaining == 0 {
+		t.untrack(f)
+	}
+
+	if report.Err != nil {
+		Logger.Printf("Could not publish audit event to %s: %v", d.Name, report.Err)
+		report.Err = &DestinationError{Destination: d.Name, Err: report.Err}
+	}
+
+	var done bool
+	switch {
+	case t.required == 0:
+		done = report.Err == nil || f.remaining == 0
+	case d.Required && report.Err != nil:
+		done = true
+	case d.Required:
+		f.required--
+		done = f.required == 0
+	}
+
+	done = done && !f.reported
+	if done {
+		f.reported = true
+	}
+	t.pendingMu.Unlock()
+
+	if done {
+		t.reporter.send(report)
+	}
+}
+
+// untrack stops tracking the audit event. The caller must hold pendingMu.
+func (t *MultiTransport) untrack(f *fanout) {
+	pending := t.pending[f.id]
+	for j, p := range pending {
+		if p == f {
+			pending = append(pending[:j], pending[j+1:]...)
+			break
+		}
+	}
+
+	if len(pending) == 0 {
+		delete(t.pending, f.id)
+	} else {
+		t.pending[f.id] = pending
+	}
+}
@@ -0,0 +1,198 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errDestination = errors.New("destination unavailable")
+
+type panickingTransport struct {
+	recordingTransport
+}
+
+func (t *panickingTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+func (t *panickingTransport) PublishContext(_ context.Context, _ *AuditEventPayload) error {
+	panic("boom")
+}
+
+func newMultiTestPublisher(dr *deliveryReports, destinations ...Destination) (Publisher, *MultiTransport) {
+	mt := NewMultiTransport(destinations...)
+	p := NewPublisher(append(dr.options(), WithTransport(mt))...)
+
+	return p, mt
+}
+
+func TestMultiTransportPublishesToAllDestinations(t *testing.T) {
+	cased, archive := &recordingTransport{}, &recordingTransport{}
+	dr := &deliveryReports{}
+	p, _ := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: cased, Required: true},
+		Destination{Name: "archive", Transport: archive, Required: true},
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Equal(t, []interface{}{"user.login"}, cased.actions())
+	assert.Equal(t, []interface{}{"user.login"}, archive.actions())
+	assert.Same(t, cased.events[0], archive.events[0])
+	assert.Len(t, dr.delivered, 1)
+	assert.Len(t, dr.failed, 0)
+	assert.NoError(t, p.Close(context.Background()))
+}
+
+func TestMultiTransportRequiredDestinationFailure(t *testing.T) {
+	dr := &deliveryReports{}
+	p, _ := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: &recordingTransport{}, Required: true},
+		Destination{Name: "archive", Transport: &recordingTransport{err: errDestination}, Required: true},
+	)
+
+	err := p.Publish(AuditEvent{"action": "user.login"})
+	var de *DestinationError
+	if assert.True(t, errors.As(err, &de), err) {
+		assert.Equal(t, "archive", de.Destination)
+	}
+	assert.True(t, errors.Is(err, errDestination))
+
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Len(t, dr.delivered, 0)
+	if assert.Len(t, dr.failed, 1) {
+		assert.True(t, errors.Is(dr.failed[0].Err, errDestination))
+	}
+}
+
+func TestMultiTransportOptionalDestinationFailure(t *testing.T) {
+	dr := &deliveryReports{}
+	p, _ := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: &recordingTransport{}, Required: true},
+		Destination{Name: "archive", Transport: &recordingTransport{err: errDestination}},
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Len(t, dr.delivered, 1)
+	assert.Len(t, dr.failed, 0)
+}
+
+func TestMultiTransportSlowOptionalDestinationDoesNotBlock(t *testing.T) {
+	gate := make(chan struct{})
+	cased := &recordingTransport{}
+	dr := &deliveryReports{}
+	p, _ := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: cased, Required: true},
+		Destination{Name: "archive", Transport: &blockingTransport{gate: gate}, QueueSize: 1},
+	)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.Len(t, cased.actions(), 5)
+	assert.Len(t, dr.delivered, 5)
+
+	close(gate)
+	assert.True(t, p.Flush(5*time.Second))
+}
+
+func TestMultiTransportWithoutRequiredDestinations(t *testing.T) {
+	dr := &deliveryReports{}
+	p, _ := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: &recordingTransport{err: errDestination}},
+		Destination{Name: "archive", Transport: &recordingTransport{}},
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Len(t, dr.delivered, 1)
+
+	dr = &deliveryReports{}
+	p, _ = newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: &recordingTransport{err: errDestination}},
+		Destination{Name: "archive", Transport: &recordingTransport{err: errDestination}},
+	)
+
+	// Audit events are accepted once queued for optional destinations.
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Len(t, dr.delivered, 0)
+	if assert.Len(t, dr.failed, 1) {
+		assert.True(t, errors.Is(dr.failed[0].Err, errDestination))
+	}
+}
+
+func TestMultiTransportRecoversFromPanickingDestination(t *testing.T) {
+	cased := &recordingTransport{}
+	dr := &deliveryReports{}
+	p, mt := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: cased, Required: true},
+		Destination{Name: "archive", Transport: &panickingTransport{}},
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.logout"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Equal(t, []interface{}{"user.login", "user.logout"}, cased.actions())
+	assert.Zero(t, pendingFanouts(mt))
+}
+
+func pendingFanouts(mt *MultiTransport) int {
+	mt.pendingMu.Lock()
+	defer mt.pendingMu.Unlock()
+
+	return len(mt.pending)
+}
+
+func TestMultiTransportSettlesDestinationsWithoutReports(t *testing.T) {
+	dr := &deliveryReports{}
+	p, mt := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: &recordingTransport{}, Required: true},
+		Destination{Name: "archive", Transport: &unreportedTransport{}, Required: true},
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+
+	assert.Len(t, dr.delivered, 1)
+	assert.Zero(t, pendingFanouts(mt))
+}
+
+func TestMultiTransportPublishesSameEventTwice(t *testing.T) {
+	cased, archive := &recordingTransport{}, &recordingTransport{}
+	dr := &deliveryReports{}
+	_, mt := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: cased, Required: true},
+		Destination{Name: "archive", Transport: archive},
+	)
+
+	event := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.NoError(t, mt.Publish(event))
+	assert.NoError(t, mt.Publish(event))
+	assert.True(t, mt.Flush(5*time.Second))
+
+	assert.Len(t, cased.events, 2)
+	assert.Len(t, archive.events, 2)
+	assert.Len(t, dr.delivered, 2)
+	assert.Zero(t, pendingFanouts(mt))
+}
+
+func TestMultiTransportClose(t *testing.T) {
+	dr := &deliveryReports{}
+	p, mt := newMultiTestPublisher(dr,
+		Destination{Name: "cased", Transport: NewHTTPSyncTransport(), Required: true},
+	)
+
+	assert.NoError(t, p.Close(context.Background()))
+	assert.NoError(t, p.Close(context.Background()))
+	assert.Equal(t, ErrClosed, mt.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"})))
+	assert.True(t, mt.Flush(time.Second))
+}
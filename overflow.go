@@ -0,0 +1,34 @@
+package cased
+
+import "errors"
+
+// ErrQueueFull is returned when an audit event could not be queued because the
+// asynchronous transport's buffer is full.
+var ErrQueueFull = errors.New("cased: audit event queue is full")
+
+// errOverflow signals the audit event must be published with the overflow
+// transport.
+var errOverflow = errors.New("cased: audit event overflowed")
+
+// OverflowPolicy determines what the asynchronous transport does with an audit
+// event published while its buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for room in the buffer. If an overflow timeout is
+	// configured, the audit event is dropped and ErrQueueFull is returned once
+	// the timeout elapses.
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowDropNewest drops the audit event being published and returns
+	// ErrQueueFull.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+
+	// OverflowDropOldest drops the oldest queued audit event to make room for
+	// the audit event being published.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+
+	// OverflowSpill publishes the audit event with the configured overflow
+	// transport, such as a SpoolTransport, instead of queuing it.
+	OverflowSpill OverflowPolicy = "spill"
+)
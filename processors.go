@@ -1,13 +1,17 @@
 package cased
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/dewski/jsonpath"
 )
 
 // Processors contains all processors available to transform an audit event
-// before it's published to Cased.
+// before it's published to Cased. Publishers configured without WithProcessors
+// run the processors in Processors at the time each audit event is published,
+// publishers configured with WithProcessors use their own processors instead.
 var Processors = []Processor{
 	SensitiveDataProcessor,
 	PublishedAtProcessor,
@@ -21,6 +25,61 @@ var Processors = []Processor{
 // called beforehand.
 type Processor func(*AuditEventPayload) *AuditEventPayload
 
+// ErrDropEvent is returned by an EventProcessor to drop the audit event. The
+// audit event is not published and publishing it does not return an error, the
+// result of Client.PublishAsync resolves with a DeliveryReport marked as
+// Dropped.
+var ErrDropEvent = errors.New("cased: audit event dropped by processor")
+
+// EventProcessor processes the audit event payload that is about to be
+// published, configured per publisher with WithProcessors. It returns an error
+// to reject the audit event, which is returned when publishing it, or
+// ErrDropEvent to drop it.
+//
+// The processors of a publisher are called in the order they are configured,
+// one after another in the goroutine publishing the audit event, before it is
+// signed and queued. Each processor sees the changes made by the processors
+// before it, and no processor is called after one returns an error.
+type EventProcessor func(context.Context, *AuditEventPayload) error
+
+// AdaptProcessor returns an EventProcessor calling the processor, such as
+// PublishedAtProcessor.
+func AdaptProcessor(processor Processor) EventProcessor {
+	return func(ctx context.Context, aep *AuditEventPayload) error {
+		processor(aep)
+		return nil
+	}
+}
+
+// DefaultProcessors returns the built-in processors, which add sensitive data
+// positions and the time the audit event was published, to include when
+// configuring a publisher with WithProcessors. Publishers configured without
+// WithProcessors run the global Processors instead, which hold the same
+// processors unless changed.
+func DefaultProcessors() []EventProcessor {
+	return []EventProcessor{
+		AdaptProcessor(SensitiveDataProcessor),
+		AdaptProcessor(PublishedAtProcessor),
+	}
+}
+
+// runProcessors calls the processors, or the global Processors if nil, with
+// the audit event until one of them returns an error.
+func runProcessors(ctx context.Context, processors []EventProcessor, aep *AuditEventPayload) error {
+	if processors == nil {
+		aep.process()
+		return nil
+	}
+
+	for _, processor := range processors {
+		if err := processor(ctx, aep); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // SensitiveDataProcessor adds sensitive data positions based on values.
 func SensitiveDataProcessor(aep *AuditEventPayload) *AuditEventPayload {
 	r := jsonpath.NewReader(aep.AuditEvent)
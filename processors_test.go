@@ -1,6 +1,8 @@
 package cased
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -49,3 +51,118 @@ func TestPublishedAtProcessorAddsPublishedAt(t *testing.T) {
 
 	assert.False(t, aep.DotCased.PublishedAt.IsZero())
 }
+
+type processorContextKey struct{}
+
+func TestPublisherProcessorsRunInOrder(t *testing.T) {
+	var calls []string
+	processor := func(name string) EventProcessor {
+		return func(ctx context.Context, aep *AuditEventPayload) error {
+			calls = append(calls, name)
+			aep.AuditEvent["processed_by"] = name
+			aep.AuditEvent["request_id"] = ctx.Value(processorContextKey{})
+			return nil
+		}
+	}
+
+	transport := &recordingTransport{}
+	p := NewPublisher(
+		WithTransport(transport),
+		WithProcessors(append(DefaultProcessors(), processor("first"), processor("second"))...),
+	)
+
+	ctx := context.WithValue(context.Background(), processorContextKey{}, "req_1")
+	assert.NoError(t, p.PublishContext(ctx, AuditEvent{
+		"action": "user.login",
+		"user":   NewSensitiveValue("John Doe", "name"),
+	}))
+
+	assert.Equal(t, []string{"first", "second"}, calls)
+	if assert.Len(t, transport.events, 1) {
+		aep := transport.events[0]
+		assert.Equal(t, "second", aep.AuditEvent["processed_by"])
+		assert.Equal(t, "req_1", aep.AuditEvent["request_id"])
+		assert.Len(t, aep.DotCased.PII[".user"], 1)
+		assert.False(t, aep.DotCased.PublishedAt.IsZero())
+	}
+}
+
+func TestPublisherProcessorsReplaceGlobalProcessors(t *testing.T) {
+	transport := &recordingTransport{}
+	p := NewPublisher(WithTransport(transport), WithProcessors())
+	assert.NoError(t, p.Publish(AuditEvent{"user": NewSensitiveValue("John Doe", "name")}))
+
+	if assert.Len(t, transport.events, 1) {
+		assert.Empty(t, transport.events[0].DotCased.PII)
+		assert.True(t, transport.events[0].DotCased.PublishedAt.IsZero())
+	}
+}
+
+func TestPublisherProcessorErrorRejectsAuditEvent(t *testing.T) {
+	errInvalid := errors.New("invalid audit event")
+	var called bool
+
+	transport := &recordingTransport{}
+	p := NewPublisher(
+		WithTransport(transport),
+		WithProcessors(
+			func(ctx context.Context, aep *AuditEventPayload) error {
+				return errInvalid
+			},
+			func(ctx context.Context, aep *AuditEventPayload) error {
+				called = true
+				return nil
+			},
+		),
+	)
+
+	assert.Equal(t, errInvalid, p.Publish(AuditEvent{"action": "user.login"}))
+
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+	assert.Equal(t, errInvalid, result.Wait(context.Background()))
+
+	assert.False(t, called)
+	assert.Empty(t, transport.events)
+}
+
+func TestPublisherProcessorDropsAuditEvent(t *testing.T) {
+	transport := &recordingTransport{}
+	p := NewPublisher(
+		WithTransport(transport),
+		WithProcessors(func(ctx context.Context, aep *AuditEventPayload) error {
+			if aep.AuditEvent["action"] == "health.check" {
+				return ErrDropEvent
+			}
+			return nil
+		}),
+	)
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "health.check"}))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+
+	// Dropped audit events are not failures, like with Publish.
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "health.check"})
+	assert.NoError(t, result.Wait(context.Background()))
+	assert.True(t, result.Report().Dropped)
+
+	result = p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+	assert.NoError(t, result.Wait(context.Background()))
+	assert.False(t, result.Report().Dropped)
+
+	assert.Equal(t, []interface{}{"user.login", "user.login"}, transport.actions())
+}
+
+func TestSchemaValidatorPublisherProcessor(t *testing.T) {
+	validator := newTestSchemaValidator(t, SchemaReject)
+
+	transport := &recordingTransport{}
+	p := NewPublisher(
+		WithTransport(transport),
+		WithProcessors(append([]EventProcessor{validator.Process}, DefaultProcessors()...)...),
+	)
+
+	var sve *SchemaValidationError
+	assert.True(t, errors.As(p.Publish(AuditEvent{"action": "user.login"}), &sve))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login", "actor": "user@example.com", "location": "1.1.1.1"}))
+	assert.Len(t, transport.events, 1)
+}
@@ -1,6 +1,9 @@
 package cased
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"net/http"
 	"os"
 	"time"
@@ -30,6 +33,102 @@ type PublisherOptions struct {
 	HTTPTransport *http.Transport
 	HTTPTimeout   time.Duration `envconfig:"CASED_HTTP_TIMEOUT" default:"5s"`
 
+	// Compression is the encoding of the codec request bodies are compressed
+	// with, such as gzip. Codecs other than gzip must be registered with
+	// RegisterCodec. Request bodies are not compressed if empty.
+	Compression string `envconfig:"CASED_COMPRESSION"`
+
+	// CompressionThreshold is the size in bytes a request body must reach
+	// before it is compressed. Request bodies of any size are compressed if 0.
+	CompressionThreshold int `envconfig:"CASED_COMPRESSION_THRESHOLD" default:"1024"`
+
+	// SigningKey, if set, signs each audit event once processed so its origin
+	// can be verified with a KeySet holding the public key.
+	SigningKey ed25519.PrivateKey `ignored:"true"`
+
+	// SigningKeyID identifies the signing key audit events were signed with.
+	SigningKeyID string `envconfig:"CASED_SIGNING_KEY_ID"`
+
+	// RateLimit is the number of requests per second made to publish audit
+	// events. Requests are not limited if zero.
+	RateLimit float64 `envconfig:"CASED_RATE_LIMIT"`
+
+	// RateBurst is the number of requests that can be made at once before
+	// RateLimit applies.
+	RateBurst int `envconfig:"CASED_RATE_BURST" default:"1"`
+
+	// RateLimiter, if set, limits requests made to publish audit events instead
+	// of RateLimit and RateBurst. A RateLimiter can be shared with other
+	// publishers and endpoints.
+	RateLimiter *RateLimiter `ignored:"true"`
+
+	// MaxBatchSize is the maximum number of audit events the asynchronous
+	// transport publishes in a single request. Set to 1 to disable batching.
+	// Batching is disabled once the publish endpoint rejects a batch.
+	MaxBatchSize int `envconfig:"CASED_MAX_BATCH_SIZE" default:"100"`
+
+	// MaxBatchBytes is the maximum size in bytes of a single batched request.
+	MaxBatchBytes int `envconfig:"CASED_MAX_BATCH_BYTES" default:"1048576"`
+
+	// BatchLinger is the maximum time an audit event waits in the asynchronous
+	// transport for other audit events to be batched with.
+	BatchLinger time.Duration `envconfig:"CASED_BATCH_LINGER" default:"100ms"`
+
+	// Workers is the number of requests the asynchronous transport publishes
+	// audit events with concurrently.
+	Workers int `envconfig:"CASED_PUBLISH_WORKERS" default:"1"`
+
+	// OrderingKey, if set, returns the key of an audit event used to preserve
+	// the order audit events are published in when using multiple workers.
+	// Audit events with the same key are published in the order they were
+	// published with the client, audit events with different keys may be
+	// published out of order.
+	OrderingKey func(*AuditEventPayload) string
+
+	// OnDelivered is called once an audit event has been published.
+	OnDelivered func(DeliveryReport)
+
+	// OnFailed is called once an audit event could not be published, either
+	// because it was dropped or because all attempts to publish it failed.
+	OnFailed func(DeliveryReport)
+
+	// RetryPolicy configures how failed requests to publish audit events are
+	// retried. DefaultRetryPolicy is used if MaxAttempts is not set.
+	RetryPolicy RetryPolicy
+
+	// OverflowPolicy determines what happens to audit events published while
+	// the asynchronous transport's buffer is full.
+	OverflowPolicy OverflowPolicy `envconfig:"CASED_OVERFLOW_POLICY" default:"block"`
+
+	// OverflowTimeout is the maximum time OverflowBlock waits for room in the
+	// buffer. Waits indefinitely if zero.
+	OverflowTimeout time.Duration `envconfig:"CASED_OVERFLOW_TIMEOUT"`
+
+	// OverflowTransport publishes audit events that overflow the buffer when
+	// using OverflowSpill.
+	OverflowTransport Transporter
+
+	// CircuitBreakerThreshold is the number of consecutive failed requests after
+	// which the circuit breaker opens and requests to publish audit events fail
+	// immediately. The circuit breaker is disabled if zero.
+	CircuitBreakerThreshold int `envconfig:"CASED_CIRCUIT_BREAKER_THRESHOLD"`
+
+	// CircuitBreakerCoolDown is how long the circuit breaker stays open before a
+	// trial request is made to determine whether Cased is available again.
+	CircuitBreakerCoolDown time.Duration `envconfig:"CASED_CIRCUIT_BREAKER_COOLDOWN" default:"30s"`
+
+	// FallbackTransport publishes audit events while the circuit breaker is
+	// open, such as a SpoolTransport.
+	FallbackTransport Transporter
+
+	// Processors process each audit event before it is published, in order.
+	// The global Processors are used if nil, see EventProcessor.
+	Processors []EventProcessor `ignored:"true"`
+
+	// Metrics records the health of publishing audit events, such as the
+	// number of audit events published, failed and dropped. See MemoryMetrics.
+	Metrics Metrics
+
 	Transport Transporter
 }
 
@@ -41,6 +140,7 @@ type PublisherOption func(opts *PublisherOptions)
 type Client struct {
 	options   PublisherOptions
 	transport Transporter
+	results   *publishResults
 }
 
 // CurrentPublisher ...
@@ -68,6 +168,7 @@ func NewPublisher(opts ...PublisherOption) Publisher {
 
 	client := &Client{
 		options: publisherOpts,
+		results: newPublishResults(),
 	}
 
 	client.setupTransport()
@@ -119,6 +220,172 @@ func WithHTTPTimeout(httpTimeout time.Duration) PublisherOption {
 	}
 }
 
+// WithCompression configures the encoding of the codec request bodies are
+// compressed with, such as gzip.
+func WithCompression(encoding string) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.Compression = encoding
+	}
+}
+
+// WithCompressionThreshold configures the size in bytes a request body must
+// reach before it is compressed.
+func WithCompressionThreshold(threshold int) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.CompressionThreshold = threshold
+	}
+}
+
+// WithSigningKey signs audit events with the Ed25519 key identified by keyID.
+func WithSigningKey(keyID string, key ed25519.PrivateKey) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.SigningKeyID = keyID
+		opts.SigningKey = key
+	}
+}
+
+// WithProcessors configures the processors audit events are processed with, in
+// order, instead of the global Processors. Include DefaultProcessors to keep
+// adding sensitive data positions and the time audit events were published:
+//
+//	cased.WithProcessors(append(cased.DefaultProcessors(), enrich, filter)...)
+func WithProcessors(processors ...EventProcessor) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.Processors = append([]EventProcessor{}, processors...)
+	}
+}
+
+// WithRateLimit limits the requests made to publish audit events to rate per
+// second with bursts of up to burst requests.
+func WithRateLimit(rate float64, burst int) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.RateLimit = rate
+		opts.RateBurst = burst
+	}
+}
+
+// WithRateLimiter configures the rate limiter requests made to publish audit
+// events wait for.
+func WithRateLimiter(rateLimiter *RateLimiter) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.RateLimiter = rateLimiter
+	}
+}
+
+// WithMaxBatchSize configures the maximum number of audit events published in
+// a single request by the asynchronous transport.
+func WithMaxBatchSize(maxBatchSize int) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.MaxBatchSize = maxBatchSize
+	}
+}
+
+// WithMaxBatchBytes configures the maximum size in bytes of a single batched
+// request published by the asynchronous transport.
+func WithMaxBatchBytes(maxBatchBytes int) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.MaxBatchBytes = maxBatchBytes
+	}
+}
+
+// WithBatchLinger configures how long the asynchronous transport waits for
+// additional audit events before publishing a batch.
+func WithBatchLinger(batchLinger time.Duration) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.BatchLinger = batchLinger
+	}
+}
+
+// WithWorkers configures the number of requests the asynchronous transport
+// publishes audit events with concurrently.
+func WithWorkers(workers int) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.Workers = workers
+	}
+}
+
+// WithOrderingKey configures the key used to preserve the order of audit events
+// published with multiple workers.
+func WithOrderingKey(orderingKey func(*AuditEventPayload) string) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OrderingKey = orderingKey
+	}
+}
+
+// WithOnDelivered configures the function called once an audit event has been
+// published.
+func WithOnDelivered(onDelivered func(DeliveryReport)) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OnDelivered = onDelivered
+	}
+}
+
+// WithOnFailed configures the function called once an audit event could not be
+// published.
+func WithOnFailed(onFailed func(DeliveryReport)) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OnFailed = onFailed
+	}
+}
+
+// WithRetryPolicy configures how failed requests to publish audit events are
+// retried.
+func WithRetryPolicy(retryPolicy RetryPolicy) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.RetryPolicy = retryPolicy
+	}
+}
+
+// WithOverflowPolicy configures what happens to audit events published while
+// the asynchronous transport's buffer is full.
+func WithOverflowPolicy(overflowPolicy OverflowPolicy) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OverflowPolicy = overflowPolicy
+	}
+}
+
+// WithOverflowTimeout configures how long OverflowBlock waits for room in the
+// buffer before dropping the audit event.
+func WithOverflowTimeout(overflowTimeout time.Duration) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OverflowTimeout = overflowTimeout
+	}
+}
+
+// WithOverflowTransport enables OverflowSpill and configures the transport audit
+// events are published with when they overflow the buffer.
+func WithOverflowTransport(overflowTransport Transporter) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.OverflowPolicy = OverflowSpill
+		opts.OverflowTransport = overflowTransport
+	}
+}
+
+// WithCircuitBreaker enables the circuit breaker, which opens after the
+// threshold of consecutive failed requests and stays open for the cool-down.
+func WithCircuitBreaker(threshold int, coolDown time.Duration) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.CircuitBreakerThreshold = threshold
+		opts.CircuitBreakerCoolDown = coolDown
+	}
+}
+
+// WithFallbackTransport configures the transport audit events are published
+// with while the circuit breaker is open.
+func WithFallbackTransport(fallbackTransport Transporter) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.FallbackTransport = fallbackTransport
+	}
+}
+
+// WithMetrics configures the metrics used to record the health of publishing
+// audit events.
+func WithMetrics(metrics Metrics) PublisherOption {
+	return func(opts *PublisherOptions) {
+		opts.Metrics = metrics
+	}
+}
+
 // WithTransport ...
 func WithTransport(transport Transporter) PublisherOption {
 	return func(opts *PublisherOptions) {
@@ -140,9 +407,64 @@ func (c Client) Options() PublisherOptions {
 
 // Publish ...
 func (c Client) Publish(event AuditEvent) error {
-	aep := NewAuditEventPayload(event)
+	return c.PublishContext(context.Background(), event)
+}
+
+// PublishContext publishes the audit event with the client's transport. The
+// context's cancellation and deadline are propagated to the transport.
+func (c Client) PublishContext(ctx context.Context, event AuditEvent) error {
+	aep := newAuditEventPayload(event)
+	if err := c.process(ctx, aep); err != nil {
+		if errors.Is(err, ErrDropEvent) {
+			return nil
+		}
+		return err
+	}
+	if err := c.sign(aep); err != nil {
+		return err
+	}
 
-	return c.transport.Publish(aep)
+	return c.transport.PublishContext(ctx, aep)
+}
+
+// PublishAsync publishes the audit event with the client's transport and returns
+// a handle to the outcome of publishing the audit event. The outcome is known
+// once the transport reports it, or once the audit event is accepted by
+// transports that do not report it, see DeliveryReporter.
+func (c Client) PublishAsync(ctx context.Context, event AuditEvent) *PublishResult {
+	aep := newAuditEventPayload(event)
+	err := c.process(ctx, aep)
+	if err == nil {
+		err = c.sign(aep)
+	}
+	result := c.results.add(aep)
+
+	if errors.Is(err, ErrDropEvent) {
+		c.results.resolve(DeliveryReport{Event: aep, Dropped: true})
+		return result
+	} else if err != nil {
+		c.results.resolve(DeliveryReport{Event: aep, Err: err})
+		return result
+	}
+
+	// Transports that do not report the outcome of audit events have delivered
+	// the audit event once PublishContext returns without an error.
+	err = c.transport.PublishContext(ctx, aep)
+	if err != nil || !reportsDelivery(c.transport) {
+		c.results.resolve(DeliveryReport{Event: aep, Err: err})
+	}
+
+	return result
+}
+
+// process runs the client's processors on the audit event.
+func (c Client) process(ctx context.Context, aep *AuditEventPayload) error {
+	err := runProcessors(ctx, c.options.Processors, aep)
+	if errors.Is(err, ErrDropEvent) {
+		Logger.Println("Audit event was dropped by a processor.")
+	}
+
+	return err
 }
 
 // Flush ...
@@ -150,12 +472,28 @@ func (c *Client) Flush(timeout time.Duration) bool {
 	return c.transport.Flush(timeout)
 }
 
+// FlushContext waits for audit events to be published or until the context is
+// done.
+func (c *Client) FlushContext(ctx context.Context) bool {
+	return c.transport.FlushContext(ctx)
+}
+
+// Close stops the client's transport from accepting audit events and waits for
+// queued audit events to be published until the context is done. A
+// LostEventsError is returned if not all audit events could be published.
+func (c *Client) Close(ctx context.Context) error {
+	return c.transport.Close(ctx)
+}
+
 func (c *Client) setupTransport() {
 	opts := c.options
 	transport := opts.Transport
 
 	if transport == nil {
-		if opts.PublishKey == "" {
+		if opts.PublishKey == "" && opts.Debug {
+			Logger.Print("No publish key detected, audit events will be printed to stderr instead of published to Cased. Set CASED_PUBLISH_KEY to publish audit events.")
+			transport = NewConsoleTransport(os.Stderr)
+		} else if opts.PublishKey == "" {
 			Logger.Print("No publish key detected, no audit events will be published to Cased. Set CASED_PUBLISH_KEY to publish audit events.")
 			transport = NewNoopHTTPTransport()
 		} else {
@@ -163,6 +501,6 @@ func (c *Client) setupTransport() {
 		}
 	}
 
-	transport.Configure(opts)
+	transport.Configure(c.results.hooks(observeDeliveries(opts)))
 	c.transport = transport
 }
@@ -0,0 +1,204 @@
+package cased
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixResetThreshold distinguishes rate limit reset headers sent as a Unix
+// timestamp from those sent as a number of seconds until the limit resets.
+const unixResetThreshold = 1000000000
+
+// RateLimiter limits the rate of requests made to Cased with a token bucket.
+// The bucket holds up to burst tokens and is refilled at rate tokens per
+// second, each request takes a token and waits for one if the bucket is empty.
+//
+// Requests also wait when Cased reports the rate limit was exceeded, with a
+// 429 response and its Retry-After header, or with rate limit headers such as
+// X-RateLimit-Remaining and X-RateLimit-Reset.
+//
+// A RateLimiter can be shared by publishers and endpoints using the same key
+// so they are limited together.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	until  time.Time
+}
+
+// NewRateLimiter returns a rate limiter allowing rate requests per second with
+// bursts of up to burst requests. Requests are only limited by Cased's rate
+// limit headers if rate is zero.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// newRateLimiter returns the rate limiter configured by the options, nil if
+// requests are not limited.
+func newRateLimiter(options PublisherOptions) *RateLimiter {
+	if options.RateLimiter != nil {
+		return options.RateLimiter
+	}
+
+	if options.RateLimit <= 0 {
+		return nil
+	}
+
+	return NewRateLimiter(options.RateLimit, options.RateBurst)
+}
+
+// Wait takes a token, waiting until one is available, Cased's rate limit has
+// reset, or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	if err := sleep(ctx, wait); err != nil {
+		l.cancel()
+		return err
+	}
+
+	return nil
+}
+
+// Observe updates the rate limiter with the rate limit reported in Cased's
+// response.
+func (l *RateLimiter) Observe(resp *http.Response) {
+	if l == nil || resp == nil {
+		return
+	}
+
+	now := l.now()
+	var until time.Time
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d := parseRetryAfter(resp.Header.Get("Retry-After"), now); d > 0 {
+			until = now.Add(d)
+		}
+	}
+
+	if remaining, ok := rateLimitHeader(resp.Header, "Remaining"); ok && remaining <= 0 {
+		if reset, ok := rateLimitHeader(resp.Header, "Reset"); ok {
+			if t := resetTime(reset, now); t.After(until) {
+				until = t
+			}
+		}
+	}
+
+	if until.IsZero() {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.until) {
+		Logger.Printf("Rate limit reached, waiting until %s to make requests.", until.Format(time.RFC3339))
+		l.until = until
+	}
+}
+
+// reserve takes a token and returns how long to wait before making the
+// request.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+
+	if l.rate > 0 {
+		l.refill(now)
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+
+	if d := l.until.Sub(now); d > wait {
+		wait = d
+	}
+
+	return wait
+}
+
+// cancel returns a token taken by a request that was abandoned.
+func (l *RateLimiter) cancel() {
+	if l.rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(l.now())
+	if l.tokens++; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	if now.After(l.last) {
+		l.last = now
+	}
+}
+
+// rateLimitHeader returns the value of the X-RateLimit-<name> or
+// RateLimit-<name> header.
+func rateLimitHeader(header http.Header, name string) (float64, bool) {
+	for _, key := range []string{"X-RateLimit-" + name, "RateLimit-" + name} {
+		value := strings.TrimSpace(header.Get(key))
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+
+		return n, true
+	}
+
+	return 0, false
+}
+
+// resetTime returns when the rate limit resets from a reset header, which is
+// either a Unix timestamp or a number of seconds.
+func resetTime(reset float64, now time.Time) time.Time {
+	if reset >= unixResetThreshold {
+		return time.Unix(0, int64(reset*float64(time.Second)))
+	}
+
+	return now.Add(time.Duration(reset * float64(time.Second)))
+}
@@ -0,0 +1,161 @@
+package cased
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *time.Time) {
+	now := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+	l := NewRateLimiter(rate, burst)
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	l, now := newTestRateLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, time.Duration(0), l.reserve())
+	}
+	assert.Equal(t, 500*time.Millisecond, l.reserve())
+	assert.Equal(t, time.Second, l.reserve())
+
+	// Tokens reserved by waiting requests are paid back before the bucket
+	// refills.
+	*now = now.Add(1500 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), l.reserve())
+	assert.Equal(t, 500*time.Millisecond, l.reserve())
+}
+
+func TestRateLimiterRefillsUpToBurst(t *testing.T) {
+	l, now := newTestRateLimiter(10, 2)
+
+	l.reserve()
+	l.reserve()
+	*now = now.Add(time.Hour)
+
+	assert.Equal(t, time.Duration(0), l.reserve())
+	assert.Equal(t, time.Duration(0), l.reserve())
+	assert.Equal(t, 100*time.Millisecond, l.reserve())
+}
+
+func TestRateLimiterCancelReturnsToken(t *testing.T) {
+	l := NewRateLimiter(1, 1)
+	l.reserve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, l.Wait(ctx))
+	assert.InDelta(t, time.Second, l.reserve(), float64(10*time.Millisecond))
+}
+
+func TestRateLimiterObservesRetryAfter(t *testing.T) {
+	l, now := newTestRateLimiter(0, 1)
+
+	l.Observe(&http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"5"}},
+	})
+
+	assert.Equal(t, 5*time.Second, l.reserve())
+	*now = now.Add(5 * time.Second)
+	assert.Equal(t, time.Duration(0), l.reserve())
+}
+
+func TestRateLimiterObservesRateLimitHeaders(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		wait   time.Duration
+	}{
+		{http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"30"}}, 30 * time.Second},
+		{http.Header{"Ratelimit-Remaining": []string{"0"}, "Ratelimit-Reset": []string{"2"}}, 2 * time.Second},
+		{http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"1609599905"}}, 60 * time.Second},
+		{http.Header{"X-Ratelimit-Remaining": []string{"10"}, "X-Ratelimit-Reset": []string{"30"}}, 0},
+		{http.Header{"X-Ratelimit-Remaining": []string{"0"}}, 0},
+	}
+
+	for _, test := range tests {
+		l, _ := newTestRateLimiter(0, 1)
+		l.Observe(&http.Response{StatusCode: http.StatusCreated, Header: test.header})
+
+		assert.Equal(t, test.wait, l.reserve(), test.header)
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var l *RateLimiter
+
+	assert.NoError(t, l.Wait(context.Background()))
+	l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests})
+	assert.Nil(t, newRateLimiter(PublisherOptions{}))
+}
+
+func TestPublishIsRateLimited(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRateLimit(20, 2),
+	)
+	defer restore()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+	requests, _ := ps.counts()
+	assert.Equal(t, 4, requests)
+}
+
+func TestPublishersShareRateLimiter(t *testing.T) {
+	ps := newPublishServer(t)
+	l := NewRateLimiter(0, 1)
+	p1, restore := newTestPublisher(ps, WithTransport(NewHTTPSyncTransport()), WithRateLimiter(l))
+	defer restore()
+	p2 := NewPublisher(WithPublishURL(ps.URL), WithTransport(NewHTTPSyncTransport()), WithRateLimiter(l))
+
+	assert.Equal(t, l, p1.Options().RateLimiter)
+	assert.Equal(t, l, p2.Options().RateLimiter)
+
+	l.until = time.Now().Add(100 * time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(t, p2.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestEndpointHonorsRateLimitResponse(t *testing.T) {
+	var requests []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, time.Now())
+		if len(requests) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "0.1")
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	e := GetEndpointWithConfig(APIEndpoint, &EndpointConfig{
+		URL:         String(ts.URL),
+		APIKey:      String("test"),
+		RateLimiter: NewRateLimiter(0, 1),
+	})
+
+	var out map[string]interface{}
+	assert.NoError(t, e.Call(http.MethodGet, "/", nil, &out))
+	assert.NoError(t, e.Call(http.MethodGet, "/", nil, &out))
+
+	if assert.Len(t, requests, 2) {
+		assert.True(t, requests[1].Sub(requests[0]) >= 90*time.Millisecond)
+	}
+}
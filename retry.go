@@ -0,0 +1,248 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how publishing audit events to Cased is retried when
+// a request fails with a retryable error.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made to publish an audit
+	// event, including the first attempt. Set to 1 to disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time waited before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the time waited between attempts, including the time
+	// Cased asks to wait with Retry-After.
+	MaxBackoff time.Duration
+
+	// Multiplier is applied to the backoff after each attempt.
+	Multiplier float64
+
+	// Jitter is the fraction of the backoff, between 0 and 1, that is
+	// randomized to avoid many publishers retrying in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used when no retry policy is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// Backoff returns the time to wait before the provided retry attempt. The first
+// retry is attempt 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 || p.InitialBackoff <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		backoff -= backoff * jitter * rand.Float64()
+	}
+
+	return time.Duration(backoff)
+}
+
+// PublishError is returned when an audit event could not be published to Cased,
+// either because the request could not be completed or because Cased responded
+// with an unsuccessful status.
+type PublishError struct {
+	// StatusCode is the HTTP status returned by Cased. It is zero if the request
+	// could not be completed.
+	StatusCode int
+
+	// Status is the HTTP status text returned by Cased.
+	Status string
+
+	// RetryAfter is the time Cased asked to wait before publishing again.
+	RetryAfter time.Duration
+
+	// Err is the underlying network error, if any.
+	Err error
+}
+
+func (e *PublishError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("could not publish audit event: %v", e.Err)
+	case e.StatusCode == http.StatusUnauthorized:
+		return "unauthorized"
+	default:
+		return fmt.Sprintf("Received %s while publishing audit event", e.Status)
+	}
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether publishing the audit event again may succeed.
+// Network errors, request timeouts, rate limiting and server errors are
+// retryable, all other client errors are not.
+func (e *PublishError) Retryable() bool {
+	if e.StatusCode == 0 {
+		return e.Err != nil
+	}
+
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	default:
+		return e.StatusCode >= 500
+	}
+}
+
+// retryable reports whether the error returned by post can be retried. Audit
+// events rejected by an open circuit breaker can be retried once it closes.
+func retryable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var pe *PublishError
+	if errors.As(err, &pe) {
+		return pe.Retryable()
+	}
+
+	return false
+}
+
+// parseRetryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// postWithRetry publishes the JSON encoded body to Cased, retrying according to
+// the retry policy. The body is compressed once before the first attempt if
+// compression is configured. It returns the number of attempts made alongside
+// the last response and error.
+func postWithRetry(ctx context.Context, config publishConfig, body []byte, idempotencyKey string) (int, *http.Response, error) {
+	body, encoding, err := compress(config.codec, config.compressionThreshold, body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	policy := config.retryPolicy
+	attempts := 0
+	for {
+		if err := config.breaker.allow(); err != nil {
+			return attempts, nil, err
+		}
+
+		attempts++
+		resp, err := post(ctx, config, body, encoding, idempotencyKey)
+		opened := false
+		if ctx.Err() != nil {
+			config.breaker.release()
+		} else {
+			opened = config.breaker.record(err)
+		}
+
+		if opened {
+			// The failed request opened the circuit breaker, so the audit
+			// events are handled like those published while it is open.
+			return attempts, resp, &CircuitOpenError{Err: err}
+		}
+
+		if err == nil || ctx.Err() != nil || !retryable(err) || attempts >= policy.MaxAttempts {
+			return attempts, resp, err
+		}
+
+		wait := retryWait(policy, attempts, err)
+
+		Logger.Printf("Retrying publishing audit event in %s after attempt %d failed: %v", wait, attempts, err)
+		config.metrics.ObserveRetry()
+		if err := sleep(ctx, wait); err != nil {
+			return attempts, resp, err
+		}
+	}
+}
+
+// retryWait returns the time to wait before retrying the failed attempt. The
+// time Cased asked to wait is respected up to MaxBackoff, or the MaxBackoff of
+// DefaultRetryPolicy if the policy does not cap it, so a far-off Retry-After
+// cannot hold up publishing indefinitely.
+func retryWait(policy RetryPolicy, attempt int, err error) time.Duration {
+	wait := policy.Backoff(attempt)
+
+	var pe *PublishError
+	if !errors.As(err, &pe) || pe.RetryAfter <= wait {
+		return wait
+	}
+
+	maxWait := policy.MaxBackoff
+	if maxWait <= 0 {
+		maxWait = DefaultRetryPolicy.MaxBackoff
+	}
+
+	if pe.RetryAfter > maxWait {
+		return maxWait
+	}
+
+	return pe.RetryAfter
+}
+
+// sleep waits for the duration to elapse or the context to be done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryPolicy(options PublisherOptions) RetryPolicy {
+	if options.RetryPolicy.MaxAttempts > 0 {
+		return options.RetryPolicy
+	}
+
+	return DefaultRetryPolicy
+}
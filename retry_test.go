@@ -0,0 +1,80 @@
+package cased
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	assert.Equal(t, time.Duration(0), p.Backoff(0))
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 400*time.Millisecond, p.Backoff(3))
+	assert.Equal(t, time.Second, p.Backoff(10))
+}
+
+func TestRetryPolicyBackoffWithJitter(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		backoff := p.Backoff(2)
+		assert.True(t, backoff > 100*time.Millisecond && backoff <= 200*time.Millisecond, backoff)
+	}
+}
+
+func TestPublishErrorRetryable(t *testing.T) {
+	tests := []struct {
+		err       *PublishError
+		retryable bool
+	}{
+		{&PublishError{Err: errors.New("connection reset by peer")}, true},
+		{&PublishError{StatusCode: http.StatusRequestTimeout}, true},
+		{&PublishError{StatusCode: http.StatusTooManyRequests}, true},
+		{&PublishError{StatusCode: http.StatusInternalServerError}, true},
+		{&PublishError{StatusCode: http.StatusBadGateway}, true},
+		{&PublishError{StatusCode: http.StatusNotImplemented}, false},
+		{&PublishError{StatusCode: http.StatusBadRequest}, false},
+		{&PublishError{StatusCode: http.StatusUnauthorized}, false},
+		{&PublishError{StatusCode: http.StatusForbidden}, false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.retryable, test.err.Retryable(), test.err.Error())
+	}
+}
+
+func TestRetryWaitCapsRetryAfter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+	assert.Equal(t, 100*time.Millisecond, retryWait(p, 1, errors.New("connection reset by peer")))
+	assert.Equal(t, 5*time.Second, retryWait(p, 1, &PublishError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}))
+	assert.Equal(t, 10*time.Second, retryWait(p, 1, &PublishError{StatusCode: http.StatusTooManyRequests, RetryAfter: 24 * time.Hour}))
+
+	p.MaxBackoff = 0
+	assert.Equal(t, DefaultRetryPolicy.MaxBackoff, retryWait(p, 1, &PublishError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 24 * time.Hour}))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Fri, 01 Jan 2021 00:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Thu, 31 Dec 2020 23:59:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -0,0 +1,70 @@
+package cased
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrClosed is returned when publishing an audit event with a publisher or
+// transport that has been closed.
+var ErrClosed = errors.New("cased: publisher is closed")
+
+// LostEventsError is returned when a publisher or transport was closed before
+// all of its queued audit events could be published.
+type LostEventsError struct {
+	// Lost is the number of audit events that were not published.
+	Lost int
+
+	// Err is the reason the audit events were not published, usually the
+	// context's error.
+	Err error
+}
+
+func (e *LostEventsError) Error() string {
+	return fmt.Sprintf("cased: %d audit events were not published: %v", e.Lost, e.Err)
+}
+
+func (e *LostEventsError) Unwrap() error {
+	return e.Err
+}
+
+// CloseOnSignal closes the publisher once the process receives one of the
+// provided signals, defaulting to SIGINT and SIGTERM. Queued audit events are
+// given up to timeout to be published.
+//
+// The returned channel receives the result of closing the publisher, allowing
+// the application to exit once audit events have been published:
+//
+//	done := cased.CloseOnSignal(cased.CurrentPublisher(), 10*time.Second)
+//	// ...
+//	if err := <-done; err != nil {
+//		log.Print(err)
+//	}
+//	os.Exit(0)
+func CloseOnSignal(publisher Publisher, timeout time.Duration, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+
+	done := make(chan error, 1)
+	go func() {
+		sig := <-c
+		signal.Stop(c)
+		Logger.Printf("Received %s, publishing queued audit events.", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		done <- publisher.Close(ctx)
+	}()
+
+	return done
+}
@@ -0,0 +1,129 @@
+package cased
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsigned is returned when verifying an audit event without a
+	// signature.
+	ErrUnsigned = errors.New("cased: audit event is not signed")
+
+	// ErrInvalidSignature is returned when the signature of an audit event does
+	// not match its contents.
+	ErrInvalidSignature = errors.New("cased: invalid audit event signature")
+)
+
+// Fields of the .cased metadata holding the signature of an audit event.
+const (
+	signatureField = "signature"
+	keyIDField     = "key_id"
+)
+
+// UnknownKeyError is returned when verifying an audit event signed with a key
+// that is not in the KeySet.
+type UnknownKeyError struct {
+	KeyID string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("cased: audit event signed with unknown key %q", e.KeyID)
+}
+
+// KeySet holds the public keys audit events are verified with by their key ID.
+//
+// To rotate signing keys, publish with a new key and key ID and add its public
+// key to the KeySet, keeping the public keys of previous signing keys to
+// verify audit events signed before the rotation.
+type KeySet map[string]ed25519.PublicKey
+
+// Verify verifies the signature of an encoded audit event, such as a line
+// from a JSON Lines export. Verifying the encoded audit event is preferred to
+// VerifyPayload as decoding may change values, such as large numbers losing
+// precision.
+func (ks KeySet) Verify(data []byte) error {
+	var dc struct {
+		DotCased DotCased `json:".cased"`
+	}
+	if err := json.Unmarshal(data, &dc); err != nil {
+		return err
+	}
+
+	return ks.verify(data, dc.DotCased.KeyID, dc.DotCased.Signature)
+}
+
+// VerifyPayload verifies the signature of the audit event.
+func (ks KeySet) VerifyPayload(aep *AuditEventPayload) error {
+	data, err := json.Marshal(aep)
+	if err != nil {
+		return err
+	}
+
+	return ks.verify(data, aep.DotCased.KeyID, aep.DotCased.Signature)
+}
+
+func (ks KeySet) verify(data []byte, keyID, signature string) error {
+	if signature == "" {
+		return ErrUnsigned
+	}
+
+	key, ok := ks[keyID]
+	if !ok {
+		return &UnknownKeyError{KeyID: keyID}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	msg, err := canonicalPayload(data, signatureField)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, msg, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signPayload records the key ID in the .cased metadata of the audit event
+// and signs its canonical encoding, so the key ID is signed too, recording the
+// signature alongside it.
+func signPayload(aep *AuditEventPayload, keyID string, key ed25519.PrivateKey) error {
+	aep.DotCased.KeyID, aep.DotCased.Signature = keyID, ""
+
+	data, err := json.Marshal(aep)
+	if err != nil {
+		return err
+	}
+
+	msg, err := canonicalPayload(data, signatureField)
+	if err != nil {
+		return err
+	}
+
+	aep.DotCased.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, msg))
+
+	return nil
+}
+
+// sign signs the audit event with the client's signing key, if configured. An
+// audit event that cannot be signed is not published.
+func (c Client) sign(aep *AuditEventPayload) error {
+	if c.options.SigningKey == nil {
+		return nil
+	}
+
+	if err := signPayload(aep, c.options.SigningKeyID, c.options.SigningKey); err != nil {
+		return fmt.Errorf("cased: could not sign audit event: %w", err)
+	}
+
+	return nil
+}
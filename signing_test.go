@@ -0,0 +1,148 @@
+package cased
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSigningKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	return public, private
+}
+
+func TestSignPayload(t *testing.T) {
+	public, private := newSigningKey(t)
+	ks := KeySet{"2021-01": public}
+
+	aep := NewAuditEventPayload(AuditEvent{
+		"action": "user.login",
+		"count":  int64(9007199254740993),
+		"user":   NewSensitiveValue("user@example.com", "email"),
+	})
+	assert.NoError(t, signPayload(aep, "2021-01", private))
+
+	assert.Equal(t, "2021-01", aep.DotCased.KeyID)
+	assert.NotEmpty(t, aep.DotCased.Signature)
+	assert.NoError(t, ks.VerifyPayload(aep))
+
+	data, err := json.Marshal(aep)
+	assert.NoError(t, err)
+	assert.NoError(t, ks.Verify(data))
+
+	tampered := strings.Replace(string(data), `"action":"user.login"`, `"action":"user.logout"`, 1)
+	assert.Equal(t, ErrInvalidSignature, ks.Verify([]byte(tampered)))
+}
+
+func TestVerifyRejectsUnsignedAndUnknownKeys(t *testing.T) {
+	public, private := newSigningKey(t)
+	ks := KeySet{"current": public}
+
+	aep := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.Equal(t, ErrUnsigned, ks.VerifyPayload(aep))
+
+	assert.NoError(t, signPayload(aep, "revoked", private))
+	err := ks.VerifyPayload(aep)
+
+	var uke *UnknownKeyError
+	if assert.True(t, errors.As(err, &uke)) {
+		assert.Equal(t, "revoked", uke.KeyID)
+	}
+}
+
+func TestVerifyAfterKeyRotation(t *testing.T) {
+	oldPublic, oldPrivate := newSigningKey(t)
+	newPublic, newPrivate := newSigningKey(t)
+	ks := KeySet{"old": oldPublic, "new": newPublic}
+
+	before := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.NoError(t, signPayload(before, "old", oldPrivate))
+	after := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.NoError(t, signPayload(after, "new", newPrivate))
+
+	assert.NoError(t, ks.VerifyPayload(before))
+	assert.NoError(t, ks.VerifyPayload(after))
+
+	// Re-signing replaces the previous signature.
+	assert.NoError(t, signPayload(before, "new", newPrivate))
+	assert.NoError(t, ks.VerifyPayload(before))
+
+	// A signature made with one key does not verify with another.
+	before.DotCased.KeyID = "old"
+	assert.Equal(t, ErrInvalidSignature, ks.VerifyPayload(before))
+}
+
+func TestSignatureCoversKeyID(t *testing.T) {
+	public, private := newSigningKey(t)
+	ks := KeySet{"2021-01": public, "2021-02": public}
+
+	aep := NewAuditEventPayload(AuditEvent{"action": "user.login"})
+	assert.NoError(t, signPayload(aep, "2021-01", private))
+	assert.NoError(t, ks.VerifyPayload(aep))
+
+	data, err := json.Marshal(aep)
+	assert.NoError(t, err)
+
+	swapped := strings.Replace(string(data), `"key_id":"2021-01"`, `"key_id":"2021-02"`, 1)
+	assert.Equal(t, ErrInvalidSignature, ks.Verify([]byte(swapped)))
+}
+
+func TestPublisherFailsWhenSigningFails(t *testing.T) {
+	_, private := newSigningKey(t)
+
+	transport := &recordingTransport{}
+	p := NewPublisher(WithTransport(transport), WithSigningKey("primary", private))
+
+	// Channels cannot be encoded, so the audit event cannot be signed.
+	event := AuditEvent{"action": "user.login", "updates": make(chan int)}
+	assert.Error(t, p.Publish(event))
+
+	result := p.(*Client).PublishAsync(context.Background(), event)
+	assert.Error(t, result.Wait(context.Background()))
+
+	assert.Empty(t, transport.events)
+}
+
+func TestPublisherSignsAuditEvents(t *testing.T) {
+	public, private := newSigningKey(t)
+	ks := KeySet{"primary": public}
+
+	transport := &recordingTransport{}
+	p := NewPublisher(WithTransport(transport), WithSigningKey("primary", private))
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.logout"})
+
+	if assert.Len(t, transport.events, 2) {
+		for _, aep := range transport.events {
+			assert.Equal(t, "primary", aep.DotCased.KeyID)
+			assert.NoError(t, ks.VerifyPayload(aep))
+		}
+	}
+}
+
+func TestSignedAuditEventsKeepHashChain(t *testing.T) {
+	_, private := newSigningKey(t)
+	chain, err := NewHashChain("")
+	assert.NoError(t, err)
+
+	var lines []string
+	for _, action := range []string{"user.login", "user.logout"} {
+		aep := linkEvent(t, chain, NewAuditEventPayload(AuditEvent{"action": action}))
+		assert.NoError(t, signPayload(aep, "primary", private))
+
+		data, err := json.Marshal(aep)
+		assert.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+
+	v := verifyLines(t, lines)
+	assert.True(t, v.Valid(), v.Breaks)
+	assert.Equal(t, chain.Head(), v.Head)
+}
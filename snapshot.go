@@ -0,0 +1,128 @@
+package cased
+
+import (
+	"reflect"
+	"time"
+)
+
+// Snapshot returns a deep copy of the audit event. Maps, slices, arrays and
+// sensitive values are copied so the snapshot is not affected by later changes
+// to the audit event, values of other types are copied as they are.
+//
+// Audit events are snapshotted when they are published so the caller can
+// reuse or change the audit event while it is being published.
+func (ae AuditEvent) Snapshot() AuditEvent {
+	if ae == nil {
+		return nil
+	}
+
+	snapshot := make(AuditEvent, len(ae))
+	for key, value := range ae {
+		snapshot[key] = snapshotValue(value)
+	}
+
+	return snapshot
+}
+
+// snapshotValue returns a deep copy of the value. The types audit events are
+// commonly made of are copied directly, other maps, slices and arrays are
+// copied with reflection.
+func snapshotValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, uint, uint32, uint64, float32, float64, time.Time:
+		return v
+	case AuditEvent:
+		return v.Snapshot()
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = snapshotValue(value)
+		}
+		return m
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = snapshotValue(value)
+		}
+		return s
+	case map[string]string:
+		if v == nil {
+			return v
+		}
+		m := make(map[string]string, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return m
+	case []string:
+		if v == nil {
+			return v
+		}
+		return append(make([]string, 0, len(v)), v...)
+	case SensitiveValue:
+		return snapshotSensitiveValue(v)
+	}
+
+	return snapshotReflect(reflect.ValueOf(value)).Interface()
+}
+
+func snapshotSensitiveValue(sv SensitiveValue) SensitiveValue {
+	if sv.Ranges != nil {
+		sv.Ranges = append(make([]SensitiveRange, 0, len(sv.Ranges)), sv.Ranges...)
+	}
+
+	return sv
+}
+
+var sensitiveValueType = reflect.TypeOf(SensitiveValue{})
+
+// snapshotReflect returns a deep copy of maps, slices and arrays of any type,
+// other values are returned as they are.
+func snapshotReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(snapshotReflect(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), snapshotReflect(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(snapshotReflect(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(snapshotReflect(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		if v.Type() == sensitiveValueType {
+			return reflect.ValueOf(snapshotSensitiveValue(v.Interface().(SensitiveValue)))
+		}
+	}
+
+	return v
+}
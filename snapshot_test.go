@@ -0,0 +1,130 @@
+package cased
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSnapshotTestEvent() AuditEvent {
+	return AuditEvent{
+		"action":     "user.login",
+		"actor":      NewSensitiveValue("user@example.com", "email"),
+		"count":      3,
+		"admin":      true,
+		"created_at": time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC),
+		"location": map[string]interface{}{
+			"city":   "San Francisco",
+			"coords": []interface{}{37.7749, -122.4194},
+		},
+		"tags":    []string{"web", "sso"},
+		"headers": map[string]string{"user_agent": "cased-go"},
+		"names": map[string]SensitiveValue{
+			"first": NewSensitiveValue("John", "name"),
+		},
+		"roles":   []map[string]interface{}{{"name": "admin"}},
+		"context": AuditEvent{"request_id": "req_1"},
+		"digest":  [2]int{1, 2},
+	}
+}
+
+func TestAuditEventSnapshotIsIndependent(t *testing.T) {
+	event := newSnapshotTestEvent()
+	snapshot := event.Snapshot()
+	assert.Equal(t, newSnapshotTestEvent(), snapshot)
+
+	event["action"] = "user.logout"
+	event["location"].(map[string]interface{})["city"] = "Oakland"
+	event["location"].(map[string]interface{})["coords"].([]interface{})[0] = 0.0
+	event["tags"].([]string)[0] = "api"
+	event["headers"].(map[string]string)["user_agent"] = "curl"
+	event["names"].(map[string]SensitiveValue)["first"].Ranges[0].Label = "changed"
+	event["names"].(map[string]SensitiveValue)["last"] = NewSensitiveValue("Doe", "name")
+	event["actor"].(SensitiveValue).Ranges[0].End = 1
+	event["roles"].([]map[string]interface{})[0]["name"] = "member"
+	event["context"].(AuditEvent)["request_id"] = "req_2"
+
+	assert.Equal(t, newSnapshotTestEvent(), snapshot)
+}
+
+func TestAuditEventSnapshotKeepsNil(t *testing.T) {
+	var event AuditEvent
+	assert.Nil(t, event.Snapshot())
+
+	snapshot := AuditEvent{
+		"map":   map[string]interface{}(nil),
+		"slice": []string(nil),
+		"value": nil,
+	}.Snapshot()
+
+	assert.Nil(t, snapshot["map"].(map[string]interface{}))
+	assert.Nil(t, snapshot["slice"].([]string))
+	assert.Nil(t, snapshot["value"])
+}
+
+func TestPublishWithContextDoesNotChangeAuditEvent(t *testing.T) {
+	mp, restore := NewMockPublisher()
+	defer restore()
+
+	event := AuditEvent{"action": "user.login"}
+	ctx := context.WithValue(context.Background(), ContextKey, AuditEvent{
+		"location": "1.1.1.1",
+	})
+
+	assert.NoError(t, PublishWithContext(ctx, event))
+
+	assert.Equal(t, AuditEvent{"action": "user.login"}, event)
+	assert.Equal(t, AuditEvent{"action": "user.login", "location": "1.1.1.1"}, mp.Events[0])
+}
+
+func TestPublishSnapshotsAuditEvent(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.gate = make(chan struct{})
+	p, restore := newTestPublisher(ps, WithMaxBatchSize(1))
+	defer restore()
+
+	event := AuditEvent{"action": "user.login", "user": map[string]interface{}{"id": "1"}}
+	assert.NoError(t, p.Publish(event))
+
+	// Changing the audit event while it is being published neither races with
+	// encoding it nor changes what is published.
+	event["action"] = "user.logout"
+	event["user"].(map[string]interface{})["id"] = "2"
+	close(ps.gate)
+
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []AuditEvent{{"action": "user.login", "user": map[string]interface{}{"id": "1"}}}, ps.events)
+}
+
+func BenchmarkAuditEventSnapshot(b *testing.B) {
+	event := newSnapshotTestEvent()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		event.Snapshot()
+	}
+}
+
+// BenchmarkAuditEventSnapshotReflect measures copying the same audit event with
+// reflection alone, which the common types avoid.
+func BenchmarkAuditEventSnapshotReflect(b *testing.B) {
+	event := newSnapshotTestEvent()
+	v := reflect.ValueOf(event)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		snapshotReflect(v)
+	}
+}
+
+func BenchmarkNewAuditEventPayload(b *testing.B) {
+	event := newSnapshotTestEvent()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		NewAuditEventPayload(event)
+	}
+}
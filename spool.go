@@ -0,0 +1,673 @@
+package cased
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSpoolMaxSegmentBytes = 16 << 20
+	defaultSpoolMaxBytes        = 1 << 30
+
+	spoolSegmentExt  = ".seg"
+	spoolCursorFile  = "cursor"
+	spoolFilePerm    = 0600
+	spoolDirPerm     = 0700
+	spoolSegmentName = "%020d" + spoolSegmentExt
+)
+
+// ErrSpoolFull is returned when publishing an audit event would grow the spool
+// beyond its maximum size.
+var ErrSpoolFull = errors.New("cased: spool is full")
+
+// spoolCursor is the position of the oldest unacknowledged audit event in the
+// spool.
+type spoolCursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type spoolSegment struct {
+	seq  uint64
+	size int64
+}
+
+// SpoolTransport persists audit events to an append-only spool on disk before
+// they are published to Cased, providing at-least-once delivery across process
+// restarts.
+//
+// Audit events are appended to segment files in Dir and published in order by
+// a background worker. Once an audit event is published it is acknowledged and
+// fully acknowledged segments are removed. Audit events that were not
+// acknowledged before the process exited are published again when the spool is
+// configured.
+type SpoolTransport struct {
+	// Dir is the directory the spool is stored in.
+	Dir string
+
+	// MaxSegmentBytes is the size at which a new segment is started.
+	MaxSegmentBytes int64
+
+	// MaxBytes is the maximum size of the spool on disk. Once reached, Publish
+	// returns ErrSpoolFull until published audit events have been compacted.
+	MaxBytes int64
+
+	// Transport publishes audit events read from the spool. It must publish
+	// synchronously as audit events are acknowledged once Publish returns.
+	// Defaults to HTTPSyncTransport.
+	Transport Transporter
+
+	retryPolicy RetryPolicy
+	reporter    reporter
+
+	mu       sync.Mutex
+	err      error
+	segments []spoolSegment
+	size     int64
+	cursor   spoolCursor
+	writer   eventWriter
+	reader   *bufio.Reader
+	readFile *os.File
+	pending  int
+	drained  []chan struct{}
+	wake     chan struct{}
+	closed   bool
+
+	// replay is the number of audit events spooled by a previous process that
+	// have not been read yet. Audit events spooled by this process are kept in
+	// originals until they are read so they can be reported as published.
+	replay    int
+	originals []*AuditEventPayload
+
+	// ctx is canceled to stop the worker once the spool is closed.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+
+	start sync.Once
+}
+
+// NewSpoolTransport returns a transport that persists audit events in dir
+// before publishing them to Cased.
+func NewSpoolTransport(dir string) *SpoolTransport {
+	return &SpoolTransport{
+		Dir:             dir,
+		MaxSegmentBytes: defaultSpoolMaxSegmentBytes,
+		MaxBytes:        defaultSpoolMaxBytes,
+	}
+}
+
+// Configure opens the spool and starts publishing any audit events that were
+// not acknowledged by a previous process.
+func (t *SpoolTransport) Configure(options PublisherOptions) {
+	if t.Transport == nil {
+		t.Transport = NewHTTPSyncTransport()
+	}
+
+	// Audit events are reported by the spool once they are acknowledged.
+	inner := options
+	inner.OnDelivered, inner.OnFailed = nil, nil
+	t.Transport.Configure(inner)
+
+	t.retryPolicy = retryPolicy(options)
+	t.reporter = newReporter(options)
+
+	t.start.Do(func() {
+		t.wake = make(chan struct{}, 1)
+		t.stopped = make(chan struct{})
+		t.ctx, t.cancel = context.WithCancel(context.Background())
+
+		if err := t.open(); err != nil {
+			Logger.Printf("Could not open audit event spool in %s: %v", t.Dir, err)
+			t.err = err
+			return
+		}
+
+		go t.worker()
+	})
+}
+
+func (t *SpoolTransport) ReportsDelivery() bool {
+	return true
+}
+
+// Publish appends the audit event to the spool to be published asynchronously.
+func (t *SpoolTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext appends the audit event to the spool to be published
+// asynchronously.
+func (t *SpoolTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.reporter.report(event, 0, nil, err)
+		return err
+	}
+	data = append(data, '\n')
+
+	err = t.append(data, event)
+	if err != nil && err != ErrClosed {
+		t.reporter.report(event, 0, nil, err)
+	}
+
+	return err
+}
+
+// append writes the encoded audit event to the active segment, rotating it if
+// it is full.
+func (t *SpoolTransport) append(data []byte, event *AuditEventPayload) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if t.full(len(data)) {
+		if t.pending > 0 {
+			return ErrSpoolFull
+		}
+
+		// Acknowledged audit events are only compacted once their segment is
+		// no longer active, which may never happen if MaxBytes is reached
+		// before MaxSegmentBytes.
+		if err := t.reclaim(); err != nil {
+			return err
+		}
+
+		if t.full(len(data)) {
+			return ErrSpoolFull
+		}
+	}
+
+	active := &t.segments[len(t.segments)-1]
+	if t.MaxSegmentBytes > 0 && active.size > 0 && active.size+int64(len(data)) > t.MaxSegmentBytes {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+		active = &t.segments[len(t.segments)-1]
+	}
+
+	n, err := t.writer.Write(data)
+	if err != nil {
+		if n > 0 {
+			t.discardPartialWrite(active, n)
+		}
+		return err
+	}
+	active.size += int64(n)
+	t.size += int64(n)
+
+	if err := t.writer.Sync(); err != nil {
+		return err
+	}
+
+	t.pending++
+	t.originals = append(t.originals, event)
+	t.notify()
+
+	return nil
+}
+
+// full reports whether appending n bytes would exceed MaxBytes.
+func (t *SpoolTransport) full(n int) bool {
+	return t.MaxBytes > 0 && t.size+int64(n) > t.MaxBytes
+}
+
+// reclaim starts a new segment and removes the previous segments once all of
+// their audit events have been acknowledged.
+func (t *SpoolTransport) reclaim() error {
+	if t.readFile != nil {
+		t.readFile.Close()
+		t.readFile, t.reader = nil, nil
+	}
+
+	if err := t.rotate(); err != nil {
+		return err
+	}
+
+	for len(t.segments) > 1 {
+		if err := t.compact(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discardPartialWrite truncates the partially written audit event from the
+// active segment so the next audit event is not appended to it. If the segment
+// cannot be truncated a new segment is started instead, leaving the partial
+// audit event at the end of the previous segment where it is discarded when
+// read.
+func (t *SpoolTransport) discardPartialWrite(active *spoolSegment, n int) {
+	err := t.writer.Truncate(active.size)
+	if err == nil {
+		return
+	}
+
+	Logger.Printf("Unable to truncate partially written audit event from spool segment %d: %v", active.seq, err)
+	active.size += int64(n)
+	t.size += int64(n)
+	if err := t.rotate(); err != nil {
+		t.err = err
+	}
+}
+
+// eventWriter writes audit events to the active spool segment or audit event
+// file, implemented by *os.File.
+type eventWriter interface {
+	Write([]byte) (int, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// Flush waits for all audit events in the spool to be published.
+func (t *SpoolTransport) Flush(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return t.FlushContext(ctx)
+}
+
+// FlushContext waits for all audit events in the spool to be published or until
+// the context is done.
+func (t *SpoolTransport) FlushContext(ctx context.Context) bool {
+	t.mu.Lock()
+	if t.pending == 0 || t.err != nil {
+		t.mu.Unlock()
+		return t.err == nil
+	}
+
+	drained := make(chan struct{})
+	t.drained = append(t.drained, drained)
+	t.mu.Unlock()
+
+	select {
+	case <-drained:
+		return true
+	case <-ctx.Done():
+		Logger.Printf("Could not publish all audit events from spool: %v\n", ctx.Err())
+		return false
+	}
+}
+
+// Close stops accepting audit events and waits for the spooled audit events to
+// be published until the context is done. Audit events that were not published
+// remain in the spool and are published once the spool is configured again.
+func (t *SpoolTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed || t.err != nil || t.stopped == nil {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mu.Unlock()
+
+	t.FlushContext(ctx)
+	t.cancel()
+	<-t.stopped
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending > 0 {
+		Logger.Printf("Closed spool with %d audit events remaining, they will be published once the spool is configured again.", t.pending)
+	}
+
+	if t.readFile != nil {
+		t.readFile.Close()
+		t.readFile, t.reader = nil, nil
+	}
+
+	if err := t.writer.Close(); err != nil {
+		return err
+	}
+
+	return t.Transport.Close(ctx)
+}
+
+// open loads existing segments and the cursor from disk and starts a new
+// segment for audit events published by this process.
+func (t *SpoolTransport) open() error {
+	if err := os.MkdirAll(t.Dir, spoolDirPerm); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(t.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		t.segments = append(t.segments, spoolSegment{seq: seq, size: fi.Size()})
+	}
+	sort.Slice(t.segments, func(i, j int) bool {
+		return t.segments[i].seq < t.segments[j].seq
+	})
+
+	if data, err := ioutil.ReadFile(filepath.Join(t.Dir, spoolCursorFile)); err == nil {
+		if err := json.Unmarshal(data, &t.cursor); err != nil {
+			return fmt.Errorf("invalid spool cursor: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Remove segments that were fully acknowledged but not yet compacted.
+	for len(t.segments) > 0 && t.segments[0].seq < t.cursor.Segment {
+		if err := os.Remove(t.segmentPath(t.segments[0].seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		t.segments = t.segments[1:]
+	}
+
+	if len(t.segments) > 0 && t.segments[0].seq != t.cursor.Segment {
+		t.cursor = spoolCursor{Segment: t.segments[0].seq}
+	}
+
+	for _, s := range t.segments {
+		t.size += s.size
+
+		offset := int64(0)
+		if s.seq == t.cursor.Segment {
+			offset = t.cursor.Offset
+		}
+
+		n, err := t.countEntries(s.seq, offset)
+		if err != nil {
+			return err
+		}
+		t.pending += n
+	}
+
+	if t.pending > 0 {
+		Logger.Printf("Replaying %d unacknowledged audit events from spool.", t.pending)
+	}
+	t.replay = t.pending
+
+	if err := t.rotate(); err != nil {
+		return err
+	}
+
+	if len(t.segments) == 1 {
+		t.cursor = spoolCursor{Segment: t.segments[0].seq}
+	}
+
+	return nil
+}
+
+// countEntries returns the number of complete audit events in the segment
+// after the provided offset.
+func (t *SpoolTransport) countEntries(seq uint64, offset int64) (int, error) {
+	f, err := os.Open(t.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	r := bufio.NewReader(f)
+	for {
+		_, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+		n++
+	}
+}
+
+// rotate closes the active segment and starts a new one.
+func (t *SpoolTransport) rotate() error {
+	seq := uint64(1)
+	if len(t.segments) > 0 {
+		seq = t.segments[len(t.segments)-1].seq + 1
+	}
+
+	f, err := os.OpenFile(t.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, spoolFilePerm)
+	if err != nil {
+		return err
+	}
+
+	if t.writer != nil {
+		t.writer.Close()
+	}
+
+	t.writer = f
+	t.segments = append(t.segments, spoolSegment{seq: seq})
+
+	return nil
+}
+
+func (t *SpoolTransport) segmentPath(seq uint64) string {
+	return filepath.Join(t.Dir, fmt.Sprintf(spoolSegmentName, seq))
+}
+
+// notify wakes up the worker if it is waiting for audit events.
+func (t *SpoolTransport) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *SpoolTransport) worker() {
+	defer close(t.stopped)
+
+	for t.ctx.Err() == nil {
+		entry, err := t.next()
+		if err != nil {
+			Logger.Printf("Could not read audit event from spool: %v", err)
+			_ = sleep(t.ctx, t.retryPolicy.MaxBackoff)
+			continue
+		}
+
+		if entry == nil {
+			select {
+			case <-t.wake:
+			case <-t.ctx.Done():
+			}
+			continue
+		}
+
+		t.deliver(entry)
+	}
+}
+
+// next reads the next unacknowledged audit event from the spool, compacting
+// segments that have been fully read. It returns nil if all audit events in the
+// spool have been read.
+func (t *SpoolTransport) next() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for {
+		if t.reader == nil {
+			f, err := os.Open(t.segmentPath(t.cursor.Segment))
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := f.Seek(t.cursor.Offset, io.SeekStart); err != nil {
+				f.Close()
+				return nil, err
+			}
+
+			t.readFile = f
+			t.reader = bufio.NewReader(f)
+		}
+
+		line, err := t.reader.ReadBytes('\n')
+		if err == nil {
+			return line, nil
+		} else if err != io.EOF {
+			return nil, err
+		}
+
+		t.readFile.Close()
+		t.readFile, t.reader = nil, nil
+
+		// Audit events are written under lock so the active segment never
+		// contains a partially written audit event.
+		if t.segments[0].seq == t.segments[len(t.segments)-1].seq {
+			return nil, nil
+		}
+
+		if len(line) > 0 {
+			Logger.Printf("Discarding partially written audit event from spool segment %d.", t.cursor.Segment)
+		}
+
+		if err := t.compact(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// compact removes the oldest segment once all of its audit events have been
+// acknowledged.
+func (t *SpoolTransport) compact() error {
+	oldest := t.segments[0]
+	t.segments = t.segments[1:]
+	t.size -= oldest.size
+	t.cursor = spoolCursor{Segment: t.segments[0].seq}
+
+	if err := t.saveCursor(); err != nil {
+		return err
+	}
+
+	return os.Remove(t.segmentPath(oldest.seq))
+}
+
+// deliver publishes the spooled audit event, retrying until it succeeds or
+// fails with an error that cannot be retried. The audit event is not
+// acknowledged if the spool is closed before it could be published.
+func (t *SpoolTransport) deliver(entry []byte) {
+	event := t.original()
+	if event == nil {
+		event = &AuditEventPayload{}
+		if err := json.Unmarshal(entry, event); err != nil {
+			Logger.Printf("Discarding audit event from spool that could not be decoded: %v", err)
+			t.reporter.report(event, 0, nil, err)
+			t.ack(int64(len(entry)))
+			return
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := t.Transport.PublishContext(t.ctx, event)
+		if err == nil {
+			t.reporter.report(event, attempt, nil, nil)
+			t.ack(int64(len(entry)))
+			return
+		}
+
+		if t.ctx.Err() != nil {
+			return
+		}
+
+		if !retryable(err) {
+			Logger.Printf("Discarding audit event from spool that could not be published: %v", err)
+			t.reporter.report(event, attempt, nil, err)
+			t.ack(int64(len(entry)))
+			return
+		}
+
+		wait := t.retryPolicy.Backoff(attempt)
+		Logger.Printf("Could not publish audit event from spool, retrying in %s: %v", wait, err)
+		if sleep(t.ctx, wait) != nil {
+			return
+		}
+	}
+}
+
+// original returns the audit event that was spooled by this process for the
+// next audit event read from the spool, or nil if it was spooled by a previous
+// process.
+func (t *SpoolTransport) original() *AuditEventPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.replay > 0 {
+		t.replay--
+		return nil
+	}
+
+	event := t.originals[0]
+	t.originals[0] = nil
+	t.originals = t.originals[1:]
+
+	return event
+}
+
+// ack advances the cursor past the oldest unacknowledged audit event.
+func (t *SpoolTransport) ack(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cursor.Offset += n
+	if err := t.saveCursor(); err != nil {
+		Logger.Printf("Could not save spool cursor: %v", err)
+	}
+
+	t.pending--
+	if t.pending == 0 {
+		for _, drained := range t.drained {
+			close(drained)
+		}
+		t.drained = nil
+	}
+}
+
+// saveCursor atomically persists the cursor to disk.
+func (t *SpoolTransport) saveCursor() error {
+	data, err := json.Marshal(t.cursor)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(t.Dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, spoolFilePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,290 @@
+package cased
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingTransport struct {
+	mu       sync.Mutex
+	events   []*AuditEventPayload
+	reporter reporter
+
+	// err is returned and reported for each audit event if set.
+	err error
+}
+
+func (t *recordingTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+}
+
+func (t *recordingTransport) ReportsDelivery() bool {
+	return true
+}
+
+func (t *recordingTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+func (t *recordingTransport) PublishContext(_ context.Context, event *AuditEventPayload) error {
+	t.mu.Lock()
+	t.events = append(t.events, event)
+	t.mu.Unlock()
+
+	t.reporter.report(event, 1, nil, t.err)
+	return t.err
+}
+
+func (t *recordingTransport) Flush(_ time.Duration) bool {
+	return true
+}
+
+func (t *recordingTransport) FlushContext(_ context.Context) bool {
+	return true
+}
+
+func (t *recordingTransport) Close(_ context.Context) error {
+	return nil
+}
+
+func (t *recordingTransport) actions() []interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	actions := []interface{}{}
+	for _, e := range t.events {
+		actions = append(actions, e.AuditEvent["action"])
+	}
+	return actions
+}
+
+func tempSpoolDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cased-spool")
+	assert.NoError(t, err)
+
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	assert.NoError(t, err)
+
+	return matches
+}
+
+func TestSpoolTransportPublishesSpooledEvents(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	rt := &recordingTransport{}
+	st := NewSpoolTransport(dir)
+	st.Transport = rt
+	st.MaxSegmentBytes = 1
+	st.Configure(PublisherOptions{})
+
+	for _, action := range []string{"user.login", "user.logout", "user.delete"} {
+		assert.NoError(t, st.Publish(NewAuditEventPayload(AuditEvent{"action": action})))
+	}
+
+	assert.True(t, st.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.login", "user.logout", "user.delete"}, rt.actions())
+
+	// Only the active segment remains once all others have been acknowledged.
+	assert.Eventually(t, func() bool {
+		return len(segmentFiles(t, dir)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSpoolTransportReplaysUnacknowledgedEvents(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	var data []byte
+	for _, action := range []string{"user.login", "user.logout", "user.delete"} {
+		line, err := json.Marshal(NewAuditEventPayload(AuditEvent{"action": action}))
+		assert.NoError(t, err)
+		data = append(data, append(line, '\n')...)
+	}
+	// A partially written audit event from a crashed process.
+	data = append(data, `{"action":"user.cre`...)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "00000000000000000007.seg"), data, 0600))
+
+	// The first audit event was acknowledged by the crashed process.
+	cursor, err := json.Marshal(spoolCursor{Segment: 7, Offset: int64(bytesUntilNewline(data))})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, spoolCursorFile), cursor, 0600))
+
+	rt := &recordingTransport{}
+	st := NewSpoolTransport(dir)
+	st.Transport = rt
+	st.Configure(PublisherOptions{})
+
+	assert.True(t, st.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.logout", "user.delete"}, rt.actions())
+	assert.Eventually(t, func() bool {
+		files := segmentFiles(t, dir)
+		return len(files) == 1 && filepath.Base(files[0]) == "00000000000000000008.seg"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSpoolTransportReturnsErrSpoolFull(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	gate := make(chan struct{})
+	defer close(gate)
+
+	st := NewSpoolTransport(dir)
+	st.Transport = &blockingTransport{gate: gate}
+	st.MaxBytes = 256
+	st.Configure(PublisherOptions{})
+
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = st.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"}))
+	}
+
+	assert.Equal(t, ErrSpoolFull, err)
+}
+
+func TestSpoolTransportReclaimsAcknowledgedActiveSegment(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	rt := &recordingTransport{}
+	st := NewSpoolTransport(dir)
+	st.Transport = rt
+	st.MaxBytes = 2000
+	st.Configure(PublisherOptions{})
+	defer st.Close(context.Background())
+
+	// The spool holds fewer audit events than are published, and all of them
+	// fit in the active segment.
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, st.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"})))
+		assert.True(t, st.Flush(5*time.Second))
+	}
+
+	assert.Len(t, rt.actions(), 50)
+	assert.Len(t, segmentFiles(t, dir), 1)
+}
+
+func TestSpoolTransportCloseKeepsUnpublishedEvents(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	gate := make(chan struct{})
+	defer close(gate)
+
+	st := NewSpoolTransport(dir)
+	st.Transport = &blockingTransport{gate: gate}
+	st.Configure(PublisherOptions{})
+
+	for _, action := range []string{"user.login", "user.logout"} {
+		assert.NoError(t, st.Publish(NewAuditEventPayload(AuditEvent{"action": action})))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, st.Close(ctx))
+	assert.Equal(t, ErrClosed, st.Publish(NewAuditEventPayload(AuditEvent{"action": "user.delete"})))
+
+	rt := &recordingTransport{}
+	reopened := NewSpoolTransport(dir)
+	reopened.Transport = rt
+	reopened.Configure(PublisherOptions{})
+
+	assert.True(t, reopened.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.login", "user.logout"}, rt.actions())
+	assert.NoError(t, reopened.Close(context.Background()))
+}
+
+// shortWriter writes half of the next audit event to the spool segment and
+// fails.
+type shortWriter struct {
+	eventWriter
+
+	failed bool
+}
+
+func (w *shortWriter) Write(data []byte) (int, error) {
+	if w.failed {
+		return w.eventWriter.Write(data)
+	}
+
+	w.failed = true
+	n, _ := w.eventWriter.Write(data[:len(data)/2])
+	return n, io.ErrShortWrite
+}
+
+func TestSpoolTransportDiscardsPartialWrites(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	gate := make(chan struct{})
+	st := NewSpoolTransport(dir)
+	st.Transport = &blockingTransport{gate: gate}
+	st.Configure(PublisherOptions{})
+
+	st.mu.Lock()
+	st.writer = &shortWriter{eventWriter: st.writer}
+	st.mu.Unlock()
+
+	assert.Equal(t, io.ErrShortWrite, st.Publish(NewAuditEventPayload(AuditEvent{"action": "user.login"})))
+	assert.NoError(t, st.Publish(NewAuditEventPayload(AuditEvent{"action": "user.logout"})))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, st.Close(ctx))
+	close(gate)
+
+	// The audit event published after the partial write is intact on disk.
+	rt := &recordingTransport{}
+	reopened := NewSpoolTransport(dir)
+	reopened.Transport = rt
+	reopened.Configure(PublisherOptions{})
+
+	assert.True(t, reopened.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.logout"}, rt.actions())
+	assert.NoError(t, reopened.Close(context.Background()))
+}
+
+type blockingTransport struct {
+	recordingTransport
+
+	gate chan struct{}
+}
+
+func (t *blockingTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+func (t *blockingTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	select {
+	case <-t.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return t.recordingTransport.PublishContext(ctx, event)
+}
+
+func bytesUntilNewline(data []byte) int {
+	for i, b := range data {
+		if b == '\n' {
+			return i + 1
+		}
+	}
+	return len(data)
+}
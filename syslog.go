@@ -0,0 +1,436 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyslogAppName = "cased"
+	defaultSyslogTimeout = 10 * time.Second
+
+	// defaultSyslogSDID identifies the structured data element audit events are
+	// encoded in. 32473 is the private enterprise number reserved for
+	// documentation, see RFC 5612.
+	defaultSyslogSDID = "cased@32473"
+
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// SyslogFacility is the facility of a syslog message as defined by RFC 5424.
+type SyslogFacility int
+
+// Syslog facilities commonly used for audit events.
+const (
+	SyslogFacilityAuth     SyslogFacility = 4
+	SyslogFacilityAuthPriv SyslogFacility = 10
+	SyslogFacilityAudit    SyslogFacility = 13
+	SyslogFacilityLocal0   SyslogFacility = 16
+	SyslogFacilityLocal1   SyslogFacility = 17
+	SyslogFacilityLocal2   SyslogFacility = 18
+	SyslogFacilityLocal3   SyslogFacility = 19
+	SyslogFacilityLocal4   SyslogFacility = 20
+	SyslogFacilityLocal5   SyslogFacility = 21
+	SyslogFacilityLocal6   SyslogFacility = 22
+	SyslogFacilityLocal7   SyslogFacility = 23
+)
+
+func (f SyslogFacility) valid() bool {
+	return f >= 0 && f <= 23
+}
+
+// SyslogSeverity is the severity of a syslog message as defined by RFC 5424.
+type SyslogSeverity int
+
+// Syslog severities.
+const (
+	SyslogSeverityEmergency SyslogSeverity = iota
+	SyslogSeverityAlert
+	SyslogSeverityCritical
+	SyslogSeverityError
+	SyslogSeverityWarning
+	SyslogSeverityNotice
+	SyslogSeverityInfo
+	SyslogSeverityDebug
+)
+
+func (s SyslogSeverity) valid() bool {
+	return s >= SyslogSeverityEmergency && s <= SyslogSeverityDebug
+}
+
+// SyslogTransport sends audit events to a syslog server as RFC 5424 messages.
+// Top-level audit event fields are encoded as structured data and the entire
+// audit event is sent as JSON in the message.
+//
+// Messages are sent as datagrams over udp and unixgram networks, and framed
+// with octet counting as described by RFC 6587 over tcp, tls and unix
+// networks.
+type SyslogTransport struct {
+	// Network is one of udp, tcp, tls, unix or unixgram.
+	Network string
+
+	// Address is the address of the syslog server, or the path of the socket
+	// for unix networks.
+	Address string
+
+	// TLSConfig configures the connection for the tls network.
+	TLSConfig *tls.Config
+
+	// Hostname identifies the machine sending audit events. Defaults to the
+	// hostname reported by the operating system.
+	Hostname string
+
+	// AppName identifies the application sending audit events. Defaults to
+	// cased.
+	AppName string
+
+	// SDID is the structured data ID audit event fields are encoded with.
+	// Defaults to cased@32473.
+	SDID string
+
+	// Facility is the facility audit events are sent with unless FacilityFunc
+	// returns one. Defaults to SyslogFacilityAudit if zero or out of range, use
+	// FacilityFunc to send audit events with the kernel facility.
+	Facility SyslogFacility
+
+	// Severity is the severity audit events are sent with unless SeverityFunc
+	// returns one. Defaults to SyslogSeverityInfo if zero or out of range, use
+	// SeverityFunc to send audit events with the emergency severity.
+	Severity SyslogSeverity
+
+	// FacilityFunc, if set, returns the facility of an audit event and whether
+	// the audit event has one. Facilities out of range are ignored.
+	FacilityFunc func(*AuditEventPayload) (SyslogFacility, bool)
+
+	// SeverityFunc, if set, returns the severity of an audit event and whether
+	// the audit event has one. Severities out of range are ignored. See
+	// SyslogSeverityFromField.
+	SeverityFunc func(*AuditEventPayload) (SyslogSeverity, bool)
+
+	// Timeout bounds connecting and writing to the syslog server.
+	Timeout time.Duration
+
+	reporter reporter
+	pid      string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// NewSyslogTransport returns a transport that sends audit events to the syslog
+// server at address.
+func NewSyslogTransport(network, address string) *SyslogTransport {
+	return &SyslogTransport{
+		Network:  network,
+		Address:  address,
+		AppName:  defaultSyslogAppName,
+		SDID:     defaultSyslogSDID,
+		Facility: SyslogFacilityAudit,
+		Severity: SyslogSeverityInfo,
+		Timeout:  defaultSyslogTimeout,
+	}
+}
+
+// SyslogSeverityFromField returns a SeverityFunc that maps the value of the
+// audit event field to a severity.
+func SyslogSeverityFromField(field string, severities map[string]SyslogSeverity) func(*AuditEventPayload) (SyslogSeverity, bool) {
+	return func(event *AuditEventPayload) (SyslogSeverity, bool) {
+		value, ok := event.AuditEvent[field]
+		if !ok {
+			return 0, false
+		}
+
+		severity, ok := severities[fmt.Sprint(value)]
+		return severity, ok
+	}
+}
+
+// SyslogFacilityFromField returns a FacilityFunc that maps the value of the
+// audit event field to a facility.
+func SyslogFacilityFromField(field string, facilities map[string]SyslogFacility) func(*AuditEventPayload) (SyslogFacility, bool) {
+	return func(event *AuditEventPayload) (SyslogFacility, bool) {
+		value, ok := event.AuditEvent[field]
+		if !ok {
+			return 0, false
+		}
+
+		facility, ok := facilities[fmt.Sprint(value)]
+		return facility, ok
+	}
+}
+
+// Configure prepares the transport with provided client options. The
+// connection to the syslog server is established once the first audit event
+// is published.
+func (t *SyslogTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+	t.pid = strconv.Itoa(os.Getpid())
+
+	if t.Hostname == "" {
+		t.Hostname, _ = os.Hostname()
+	}
+	if t.AppName == "" {
+		t.AppName = defaultSyslogAppName
+	}
+	if t.SDID == "" {
+		t.SDID = defaultSyslogSDID
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = defaultSyslogTimeout
+	}
+	if t.Facility == 0 || !t.Facility.valid() {
+		t.Facility = SyslogFacilityAudit
+	}
+	if t.Severity == 0 || !t.Severity.valid() {
+		t.Severity = SyslogSeverityInfo
+	}
+}
+
+func (t *SyslogTransport) ReportsDelivery() bool {
+	return true
+}
+
+// Publish sends the audit event to the syslog server.
+func (t *SyslogTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext sends the audit event to the syslog server.
+func (t *SyslogTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg, err := t.format(event, time.Now())
+	if err != nil {
+		t.reporter.report(event, 0, nil, err)
+		return err
+	}
+
+	attempts, err := t.send(msg)
+	if err == ErrClosed {
+		return err
+	}
+
+	t.reporter.report(event, attempts, nil, err)
+	return err
+}
+
+// Flush is unused.
+func (t *SyslogTransport) Flush(_ time.Duration) bool {
+	return true
+}
+
+// FlushContext is unused.
+func (t *SyslogTransport) FlushContext(_ context.Context) bool {
+	return true
+}
+
+// Close closes the connection to the syslog server.
+func (t *SyslogTransport) Close(_ context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// send writes the message, reconnecting and trying again once if the
+// connection was lost.
+func (t *SyslogTransport) send(msg []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return 0, ErrClosed
+	}
+
+	if t.stream() {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	var err error
+	for attempt := 1; attempt <= 2; attempt++ {
+		if t.conn == nil {
+			if t.conn, err = t.dial(); err != nil {
+				return attempt, err
+			}
+		}
+
+		_ = t.conn.SetWriteDeadline(time.Now().Add(t.Timeout))
+		if _, err = t.conn.Write(msg); err == nil {
+			return attempt, nil
+		}
+
+		t.conn.Close()
+		t.conn = nil
+	}
+
+	return 2, err
+}
+
+func (t *SyslogTransport) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: t.Timeout}
+
+	if t.Network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", t.Address, t.TLSConfig)
+	}
+
+	return dialer.Dial(t.Network, t.Address)
+}
+
+// stream reports whether messages are sent over a stream and need to be framed.
+func (t *SyslogTransport) stream() bool {
+	switch t.Network {
+	case "tcp", "tcp4", "tcp6", "tls", "unix":
+		return true
+	default:
+		return false
+	}
+}
+
+// format encodes the audit event as an RFC 5424 message.
+func (t *SyslogTransport) format(event *AuditEventPayload, now time.Time) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	facility := t.Facility
+	if t.FacilityFunc != nil {
+		if f, ok := t.FacilityFunc(event); ok && f.valid() {
+			facility = f
+		} else if ok {
+			Logger.Printf("Ignoring syslog facility %d out of range.", f)
+		}
+	}
+
+	severity := t.Severity
+	if t.SeverityFunc != nil {
+		if s, ok := t.SeverityFunc(event); ok && s.valid() {
+			severity = s
+		} else if ok {
+			Logger.Printf("Ignoring syslog severity %d out of range.", s)
+		}
+	}
+
+	timestamp := event.DotCased.PublishedAt
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+
+	action, _ := event.AuditEvent["action"].(string)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s ",
+		int(facility)*8+int(severity),
+		timestamp.Format(syslogTimeFormat),
+		syslogHeaderField(t.Hostname, 255),
+		syslogHeaderField(t.AppName, 48),
+		syslogHeaderField(t.pid, 128),
+		syslogHeaderField(action, 32),
+	)
+	t.structuredData(&buf, event)
+	buf.WriteByte(' ')
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// structuredData writes the ID and top-level fields of the audit event as an
+// SD-ELEMENT. Fields that are not valid parameter names or hold nested values
+// are only included in the message.
+func (t *SyslogTransport) structuredData(buf *bytes.Buffer, event *AuditEventPayload) {
+	buf.WriteByte('[')
+	buf.WriteString(t.SDID)
+
+	if event.DotCased.ID != "" {
+		writeSyslogParam(buf, "id", event.DotCased.ID)
+	}
+
+	keys := make([]string, 0, len(event.AuditEvent))
+	for key := range event.AuditEvent {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "id" || !validSyslogName(key) {
+			continue
+		}
+
+		switch v := event.AuditEvent[key].(type) {
+		case string:
+			writeSyslogParam(buf, key, v)
+		case SensitiveValue:
+			writeSyslogParam(buf, key, v.Value)
+		case bool, int, int32, int64, uint, uint32, uint64, float32, float64, json.Number:
+			writeSyslogParam(buf, key, fmt.Sprint(v))
+		}
+	}
+
+	buf.WriteByte(']')
+}
+
+func writeSyslogParam(buf *bytes.Buffer, name, value string) {
+	buf.WriteByte(' ')
+	buf.WriteString(name)
+	buf.WriteString(`="`)
+	for _, r := range value {
+		switch r {
+		case '"', '\\', ']':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('"')
+}
+
+// validSyslogName reports whether the name can be used as an SD-NAME.
+func validSyslogName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// syslogHeaderField returns the value as printable ASCII truncated to the max
+// length, or the nil value if it is empty.
+func syslogHeaderField(value string, max int) string {
+	b := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(b) < max; i++ {
+		if c := value[i]; c >= 33 && c <= 126 {
+			b = append(b, c)
+		}
+	}
+
+	if len(b) == 0 {
+		return "-"
+	}
+
+	return string(b)
+}
@@ -0,0 +1,271 @@
+package cased
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSyslogTestTransport(network, address string) *SyslogTransport {
+	st := NewSyslogTransport(network, address)
+	st.Hostname = "app-1"
+	st.Configure(PublisherOptions{})
+
+	return st
+}
+
+func testSyslogEvent() *AuditEventPayload {
+	event := NewAuditEventPayload(AuditEvent{
+		"action":  "user.login",
+		"actor":   "dewski",
+		"success": true,
+		"reason":  `said "hi" [ok]`,
+		"request": map[string]interface{}{"method": "POST"},
+	})
+	event.DotCased.PublishedAt = time.Date(2021, 1, 2, 15, 4, 5, 123456789, time.UTC)
+
+	return event
+}
+
+// readOctetCounted reads a single message framed with octet counting.
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if !assert.NoError(t, err) {
+		return ""
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	assert.NoError(t, err)
+
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	assert.NoError(t, err)
+
+	return string(msg)
+}
+
+func assertSyslogMessage(t *testing.T, event *AuditEventPayload, msg string) {
+	header := regexp.MustCompile(`^<110>1 2021-01-02T15:04:05\.123456Z app-1 cased \d+ user\.login \[`)
+	assert.Regexp(t, header, msg)
+	assert.Contains(t, msg, `[cased@32473 id="`+event.DotCased.ID+`" action="user.login" actor="dewski" reason="said \"hi\" [ok\]" success="true"] {`)
+	assert.NotContains(t, msg, `request="`)
+	assert.Contains(t, msg, `"request":{"method":"POST"}`)
+}
+
+func TestSyslogTransportUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	st := newSyslogTestTransport("udp", conn.LocalAddr().String())
+	defer st.Close(context.Background())
+
+	event := testSyslogEvent()
+	assert.NoError(t, st.Publish(event))
+
+	buf := make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assertSyslogMessage(t, event, string(buf[:n]))
+}
+
+func TestSyslogTransportTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			messages <- readOctetCounted(t, r)
+		}
+	}()
+
+	st := newSyslogTestTransport("tcp", ln.Addr().String())
+	defer st.Close(context.Background())
+
+	event := testSyslogEvent()
+	assert.NoError(t, st.Publish(event))
+	assert.NoError(t, st.Publish(event))
+
+	for i := 0; i < 2; i++ {
+		assertSyslogMessage(t, event, <-messages)
+	}
+}
+
+func TestSyslogTransportTLS(t *testing.T) {
+	cert := selfSignedCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		messages <- readOctetCounted(t, bufio.NewReader(conn))
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	st := newSyslogTestTransport("tls", ln.Addr().String())
+	st.TLSConfig = &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	defer st.Close(context.Background())
+
+	event := testSyslogEvent()
+	assert.NoError(t, st.Publish(event))
+	assertSyslogMessage(t, event, <-messages)
+}
+
+func TestSyslogTransportUnixgram(t *testing.T) {
+	dir, cleanup := tempSpoolDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "syslog.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	st := newSyslogTestTransport("unixgram", path)
+	defer st.Close(context.Background())
+
+	event := testSyslogEvent()
+	assert.NoError(t, st.Publish(event))
+
+	buf := make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assertSyslogMessage(t, event, string(buf[:n]))
+}
+
+func TestSyslogTransportSeverityMapping(t *testing.T) {
+	st := newSyslogTestTransport("udp", "127.0.0.1:0")
+	st.Facility = SyslogFacilityLocal4
+	st.SeverityFunc = SyslogSeverityFromField("action", map[string]SyslogSeverity{
+		"user.login_failed": SyslogSeverityWarning,
+	})
+	st.FacilityFunc = SyslogFacilityFromField("category", map[string]SyslogFacility{
+		"auth": SyslogFacilityAuthPriv,
+	})
+
+	msg, err := st.format(NewAuditEventPayload(AuditEvent{"action": "user.login_failed"}), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(msg), "<164>1 "), string(msg))
+
+	msg, err = st.format(NewAuditEventPayload(AuditEvent{"action": "user.login", "category": "auth"}), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(msg), "<86>1 "), string(msg))
+}
+
+func TestSyslogTransportDefaultsFacilityAndSeverity(t *testing.T) {
+	st := &SyslogTransport{Network: "udp", Address: "127.0.0.1:0"}
+	st.Configure(PublisherOptions{})
+
+	msg, err := st.format(NewAuditEventPayload(AuditEvent{"action": "user.login"}), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(msg), "<110>1 "), string(msg))
+
+	st = &SyslogTransport{Facility: 24, Severity: -1}
+	st.Configure(PublisherOptions{})
+	assert.Equal(t, SyslogFacilityAudit, st.Facility)
+	assert.Equal(t, SyslogSeverityInfo, st.Severity)
+}
+
+func TestSyslogTransportIgnoresOutOfRangeMappings(t *testing.T) {
+	st := newSyslogTestTransport("udp", "127.0.0.1:0")
+	st.FacilityFunc = func(*AuditEventPayload) (SyslogFacility, bool) {
+		return 24, true
+	}
+	st.SeverityFunc = func(*AuditEventPayload) (SyslogSeverity, bool) {
+		return 8, true
+	}
+
+	msg, err := st.format(NewAuditEventPayload(AuditEvent{"action": "user.login"}), time.Now())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(msg), "<110>1 "), string(msg))
+}
+
+func TestSyslogTransportReportsFailures(t *testing.T) {
+	dr := &deliveryReports{}
+	opts := PublisherOptions{}
+	for _, opt := range dr.options() {
+		opt(&opts)
+	}
+
+	// Nothing listens on the socket.
+	st := NewSyslogTransport("unix", filepath.Join("does", "not", "exist.sock"))
+	st.Configure(opts)
+
+	assert.Error(t, st.Publish(testSyslogEvent()))
+	if assert.Len(t, dr.failed, 1) {
+		assert.Error(t, dr.failed[0].Err)
+	}
+
+	assert.NoError(t, st.Close(context.Background()))
+	assert.Equal(t, ErrClosed, st.Publish(testSyslogEvent()))
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
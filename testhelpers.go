@@ -1,6 +1,9 @@
 package cased
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type MockPublisher struct {
 	Events  []AuditEvent
@@ -39,8 +42,24 @@ func (mp MockPublisher) Flush(_ time.Duration) bool {
 	return true
 }
 
+func (mp MockPublisher) FlushContext(_ context.Context) bool {
+	return true
+}
+
+func (mp MockPublisher) Close(_ context.Context) error {
+	return nil
+}
+
 func (mp *MockPublisher) Publish(event AuditEvent) error {
 	mp.Events = append(mp.Events, event)
 
 	return nil
 }
+
+func (mp *MockPublisher) PublishContext(ctx context.Context, event AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return mp.Publish(event)
+}
@@ -2,28 +2,53 @@ package cased
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const defaultBufferSize = 100
 const defaultTimeout = 10 * time.Second
 
+const (
+	defaultMaxBatchSize  = 100
+	defaultMaxBatchBytes = 1 << 20
+	defaultBatchLinger   = 100 * time.Millisecond
+)
+
 // Transporter ...
 type Transporter interface {
 	Configure(options PublisherOptions)
 	Publish(event *AuditEventPayload) error
+	PublishContext(ctx context.Context, event *AuditEventPayload) error
 	Flush(timeout time.Duration) bool
+	FlushContext(ctx context.Context) bool
+	Close(ctx context.Context) error
 }
 
 type batch struct {
 	events  chan *AuditEventPayload
 	started chan struct{}
 	done    chan struct{}
+
+	// closed marks the buffer as closed, no further audit events are accepted.
+	closed bool
+}
+
+func newBatch(size int) batch {
+	return batch{
+		events:  make(chan *AuditEventPayload, size),
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
 }
 
 // HTTPTransport ...
@@ -32,10 +57,40 @@ type HTTPTransport struct {
 	transport *http.Transport
 	timeout   time.Duration
 
+	config   publishConfig
+	reporter reporter
+
+	maxBatchSize  int
+	maxBatchBytes int
+	batchLinger   time.Duration
+
+	// unbatched is set once the publish endpoint rejects a batch, after which
+	// audit events are published individually.
+	unbatched int32
+
+	workers     int
+	orderingKey func(*AuditEventPayload) string
+
+	overflowPolicy    OverflowPolicy
+	overflowTimeout   time.Duration
+	overflowTransport Transporter
+	dropped           uint64
+
+	fallbackTransport Transporter
+
+	// queued is the number of audit events in the buffer that have not been
+	// published yet.
+	queued int64
+
 	BufferSize int
 
 	buffer chan batch
 
+	// ctx is canceled once the transport is closed and the deadline to publish
+	// queued audit events has passed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	start sync.Once
 }
 
@@ -49,17 +104,6 @@ func NewHTTPTransport() *HTTPTransport {
 // Configure prepares the asynchronous audit event publisher with provided
 // client options.
 func (t *HTTPTransport) Configure(options PublisherOptions) {
-	// Heavily influenced by Sentry's flush pattern, requirements align closely.
-	t.buffer = make(chan batch, 1)
-
-	// Prepare buffer with its first batch, used to obtain batch when publishing
-	// first audit event.
-	t.buffer <- batch{
-		events:  make(chan *AuditEventPayload, t.BufferSize),
-		started: make(chan struct{}),
-		done:    make(chan struct{}),
-	}
-
 	if options.HTTPTransport != nil {
 		t.transport = options.HTTPTransport
 	} else {
@@ -81,34 +125,106 @@ func (t *HTTPTransport) Configure(options PublisherOptions) {
 		}
 	}
 
+	t.config = newPublishConfig(t.client, options)
+	t.reporter = newReporter(options)
+
+	t.overflowPolicy = options.OverflowPolicy
+	t.overflowTimeout = options.OverflowTimeout
+	t.overflowTransport = options.OverflowTransport
+	switch t.overflowPolicy {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+	case OverflowSpill:
+		if t.overflowTransport == nil {
+			Logger.Print("No overflow transport configured, audit events will be dropped when the buffer is full.")
+			t.overflowPolicy = OverflowDropNewest
+		} else {
+			t.overflowTransport.Configure(childOptions(options))
+		}
+	default:
+		t.overflowPolicy = OverflowBlock
+	}
+
+	t.fallbackTransport = options.FallbackTransport
+	if t.fallbackTransport != nil {
+		t.fallbackTransport.Configure(childOptions(options))
+	}
+
+	if options.MaxBatchSize > 0 {
+		t.maxBatchSize = options.MaxBatchSize
+	} else {
+		t.maxBatchSize = defaultMaxBatchSize
+	}
+
+	if options.MaxBatchBytes > 0 {
+		t.maxBatchBytes = options.MaxBatchBytes
+	} else {
+		t.maxBatchBytes = defaultMaxBatchBytes
+	}
+
+	if options.BatchLinger > 0 {
+		t.batchLinger = options.BatchLinger
+	} else {
+		t.batchLinger = defaultBatchLinger
+	}
+
+	if options.Workers > 0 {
+		t.workers = options.Workers
+	} else {
+		t.workers = 1
+	}
+	t.orderingKey = options.OrderingKey
+
 	t.start.Do(func() {
+		// Heavily influenced by Sentry's flush pattern, requirements align closely.
+		t.buffer = make(chan batch, 1)
+
+		// Prepare buffer with its first batch, used to obtain batch when
+		// publishing first audit event.
+		t.buffer <- newBatch(t.BufferSize)
+
+		t.ctx, t.cancel = context.WithCancel(context.Background())
+
 		go t.worker()
 	})
 }
 
+// ReportsDelivery returns true. Audit events accepted by an overflow or
+// fallback transport that does not report delivery are reported as delivered by the transport.
+func (t *HTTPTransport) ReportsDelivery() bool {
+	return true
+}
+
 // Flush waits for all audit events to be published that are in the buffer.
 func (t *HTTPTransport) Flush(timeout time.Duration) bool {
-	expired := time.After(timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return t.FlushContext(ctx)
+}
 
+// FlushContext waits for all audit events to be published that are in the
+// buffer or until the context is done.
+func (t *HTTPTransport) FlushContext(ctx context.Context) bool {
 	for {
 		select {
 		case b := <-t.buffer:
+			if b.closed {
+				t.buffer <- b
+				return true
+			}
+
 			select {
 			case <-b.started:
 				close(b.events)
 
-				t.buffer <- batch{
-					events:  make(chan *AuditEventPayload, t.BufferSize),
-					started: make(chan struct{}),
-					done:    make(chan struct{}),
-				}
+				t.buffer <- newBatch(t.BufferSize)
 
 				select {
 				case <-b.done:
 					Logger.Println("Published all audit events in buffer.")
-					return true
-				case <-expired:
-					Logger.Printf("Could not flush all audit events from buffer, timed out after %s.\n", timeout.String())
+					return t.flushChildren(ctx)
+				case <-ctx.Done():
+					Logger.Printf("Could not flush all audit events from buffer: %v\n", ctx.Err())
 					return false
 				}
 
@@ -116,31 +232,227 @@ func (t *HTTPTransport) Flush(timeout time.Duration) bool {
 				// Put buffer back until it has started
 				t.buffer <- b
 			}
-		case <-expired:
-			Logger.Printf("Could not flush all audit events from buffer, timed out after %s.\n", timeout.String())
+		case <-ctx.Done():
+			Logger.Printf("Could not flush all audit events from buffer: %v\n", ctx.Err())
 			return false
 		}
 	}
 }
 
+// flushChildren waits for the audit events published with the overflow and
+// fallback transports.
+func (t *HTTPTransport) flushChildren(ctx context.Context) bool {
+	flushed := true
+	for _, child := range []Transporter{t.overflowTransport, t.fallbackTransport} {
+		if child != nil && !child.FlushContext(ctx) {
+			flushed = false
+		}
+	}
+
+	return flushed
+}
+
 // Publish queues the audit event to be published in the asynchronously.
 //
+// If the buffer is full the configured OverflowPolicy determines whether the
+// audit event waits for room in the buffer, is dropped, or is published with
+// the overflow transport.
+//
 // To ensure queued audit events are published at end of process see Flush.
 func (t *HTTPTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext queues the audit event to be published asynchronously. The
+// context bounds how long PublishContext waits for room in the buffer, it does
+// not apply to publishing the audit event once queued.
+func (t *HTTPTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
 	// Obtain the buffer lock
-	b := <-t.buffer
+	var b batch
+	select {
+	case b = <-t.buffer:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if b.closed {
+		t.buffer <- b
+		return ErrClosed
+	}
 
 	// Add the event to the buffer
-	b.events <- event
+	err := t.enqueue(ctx, b, event)
 
 	// Release buffer lock
 	t.buffer <- b
 
+	if err == errOverflow {
+		err = t.overflowTransport.PublishContext(ctx, event)
+		if err == nil {
+			reportHandOff(t.reporter, t.overflowTransport, event, 0)
+		}
+	}
+
+	return err
+}
+
+// Dropped returns the number of audit events dropped because the buffer was
+// full.
+func (t *HTTPTransport) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close stops accepting audit events and waits for queued audit events to be
+// published until the context is done. If the context is done first, the
+// number of audit events that were not published is reported with a
+// LostEventsError.
+func (t *HTTPTransport) Close(ctx context.Context) error {
+	if t.buffer == nil {
+		return nil
+	}
+
+	// Obtain the buffer once the worker has started processing it, otherwise
+	// the queued audit events would never be published.
+	var b batch
+	for started := false; !started; {
+		select {
+		case b = <-t.buffer:
+		case <-ctx.Done():
+			t.cancel()
+			return &LostEventsError{Lost: int(atomic.LoadInt64(&t.queued)), Err: ctx.Err()}
+		}
+
+		if b.closed {
+			t.buffer <- b
+			return nil
+		}
+
+		select {
+		case <-b.started:
+			started = true
+		default:
+			// Put buffer back until it has started
+			t.buffer <- b
+		}
+	}
+
+	// The worker stops once it has published the remaining audit events and
+	// obtains the closed buffer.
+	close(b.events)
+	t.buffer <- batch{closed: true}
+
+	var lost int
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		lost = int(atomic.LoadInt64(&t.queued))
+	}
+
+	// Abort any requests still in flight.
+	t.cancel()
+
+	for _, child := range []Transporter{t.overflowTransport, t.fallbackTransport} {
+		if child == nil {
+			continue
+		}
+
+		if err := child.Close(ctx); err != nil {
+			var lee *LostEventsError
+			if !errors.As(err, &lee) {
+				return err
+			}
+			lost += lee.Lost
+		}
+	}
+
+	if lost > 0 {
+		Logger.Printf("Closed transport before %d audit events could be published.", lost)
+		return &LostEventsError{Lost: lost, Err: ctx.Err()}
+	}
+
+	Logger.Println("Published all audit events in buffer, transport closed.")
 	return nil
 }
 
+func (t *HTTPTransport) enqueue(ctx context.Context, b batch, event *AuditEventPayload) error {
+	err := t.push(ctx, b, event)
+	if err == nil {
+		t.addQueued(1)
+	}
+
+	return err
+}
+
+// addQueued adjusts the number of queued audit events and reports the new queue
+// depth to the configured metrics.
+func (t *HTTPTransport) addQueued(delta int) {
+	atomic.AddInt64(&t.queued, int64(delta))
+	t.config.metrics.AddQueueDepth(delta)
+}
+
+func (t *HTTPTransport) push(ctx context.Context, b batch, event *AuditEventPayload) error {
+	select {
+	case b.events <- event:
+		return nil
+	default:
+	}
+
+	switch t.overflowPolicy {
+	case OverflowDropNewest:
+		t.drop(event)
+		return ErrQueueFull
+	case OverflowDropOldest:
+		for {
+			select {
+			case b.events <- event:
+				return nil
+			default:
+			}
+
+			// The worker may have emptied the buffer in the meantime.
+			select {
+			case oldest := <-b.events:
+				t.addQueued(-1)
+				t.drop(oldest)
+			default:
+			}
+		}
+	case OverflowSpill:
+		return errOverflow
+	}
+
+	var expired <-chan time.Time
+	if t.overflowTimeout > 0 {
+		timer := time.NewTimer(t.overflowTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case b.events <- event:
+		return nil
+	case <-expired:
+		t.drop(event)
+		return ErrQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *HTTPTransport) drop(event *AuditEventPayload) {
+	dropped := atomic.AddUint64(&t.dropped, 1)
+	Logger.Printf("Dropped audit event because the buffer is full, %d audit events dropped in total.", dropped)
+	t.reporter.report(event, 0, nil, ErrQueueFull)
+}
+
 func (t *HTTPTransport) worker() {
 	for b := range t.buffer {
+		if b.closed {
+			// Release lock on buffer for any other callers.
+			t.buffer <- b
+			return
+		}
+
 		// Signal batch has started processing.
 		close(b.started)
 
@@ -148,17 +460,203 @@ func (t *HTTPTransport) worker() {
 		t.buffer <- b
 
 		// Publish all audit events to Cased based on client's configuration.
-		for event := range b.events {
-			_, err := publish(t.client, event)
+		t.dispatch(b.events)
+
+		// Signal that processing of the batch is done. Useful for when flushing
+		// audit events at end of process.
+		close(b.done)
+	}
+}
+
+// dispatch publishes audit events with the configured number of concurrent
+// senders. It returns once events is closed and all audit events have been
+// published.
+func (t *HTTPTransport) dispatch(events <-chan *AuditEventPayload) {
+	if t.workers <= 1 {
+		t.drain(events)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(t.workers)
+
+	if t.orderingKey == nil {
+		for i := 0; i < t.workers; i++ {
+			go func() {
+				defer wg.Done()
+				t.drain(events)
+			}()
+		}
+
+		wg.Wait()
+		return
+	}
+
+	// Audit events with the same ordering key are always published by the same
+	// sender, which publishes them in the order they were queued.
+	partitions := make([]chan *AuditEventPayload, t.workers)
+	for i := range partitions {
+		partitions[i] = make(chan *AuditEventPayload)
+		go func(events <-chan *AuditEventPayload) {
+			defer wg.Done()
+			t.drain(events)
+		}(partitions[i])
+	}
+
+	for event := range events {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(t.orderingKey(event)))
+		partitions[h.Sum32()%uint32(len(partitions))] <- event
+	}
+
+	for _, partition := range partitions {
+		close(partition)
+	}
+
+	wg.Wait()
+}
+
+// encodedEvent is an audit event alongside its JSON representation, used to
+// keep track of the size of a batch before it is published.
+type encodedEvent struct {
+	event *AuditEventPayload
+	body  []byte
+}
+
+// drain coalesces queued audit events into batches and publishes them until
+// events is closed. A batch is published once it reaches the maximum number
+// of events or bytes, or once the oldest event in the batch has waited for the
+// configured linger time.
+func (t *HTTPTransport) drain(events <-chan *AuditEventPayload) {
+	var (
+		batch  []encodedEvent
+		timer  *time.Timer
+		linger <-chan time.Time
+
+		// size starts at one to account for the opening bracket of the JSON
+		// array the batch is encoded as.
+		size = 1
+	)
+
+	send := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		if len(batch) > 0 {
+			t.send(batch)
+		}
+
+		batch, size, timer, linger = nil, 1, nil, nil
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				send()
+				return
+			}
+
+			body, err := json.Marshal(event)
 			if err != nil {
-				Logger.Printf("There was an issue with publishing audit event: %v", err)
+				t.addQueued(-1)
+				Logger.Printf("There was an issue with encoding audit event: %v", err)
+				t.reporter.report(event, 0, nil, err)
 				continue
 			}
+
+			// Each event in a batch is followed by either a comma or the closing
+			// bracket of the JSON array.
+			if len(batch) > 0 && size+len(body)+1 > t.maxBatchBytes {
+				send()
+			}
+
+			batch = append(batch, encodedEvent{event: event, body: body})
+			size += len(body) + 1
+
+			if len(batch) >= t.maxBatchSize || size >= t.maxBatchBytes {
+				send()
+			} else if linger == nil {
+				timer = time.NewTimer(t.batchLinger)
+				linger = timer.C
+			}
+		case <-linger:
+			send()
 		}
+	}
+}
 
-		// Signal that processing of the batch is done. Useful for when flushing
-		// audit events at end of process.
-		close(b.done)
+// send publishes a batch of audit events in a single request. If the publish
+// endpoint rejects the batch, each audit event is published individually, as
+// are all audit events published with the transport afterwards.
+func (t *HTTPTransport) send(batch []encodedEvent) {
+	defer t.addQueued(-len(batch))
+
+	if len(batch) == 1 || atomic.LoadInt32(&t.unbatched) == 1 {
+		for _, e := range batch {
+			t.sendOne(e)
+		}
+		return
+	}
+
+	bodies := make([][]byte, len(batch))
+	for i, e := range batch {
+		bodies[i] = e.body
+	}
+
+	attempts, resp, err := postWithRetry(t.ctx, t.config, encodeBatch(bodies), "")
+	if errors.Is(err, ErrCircuitOpen) && t.fallbackTransport != nil {
+		for _, e := range batch {
+			t.fallback(e.event, attempts)
+		}
+		return
+	}
+
+	if err == nil || resp == nil || !batchRejected(resp.StatusCode) {
+		if err != nil {
+			Logger.Printf("There was an issue with publishing %d audit events after %d attempts: %v", len(batch), attempts, err)
+		}
+
+		for _, e := range batch {
+			t.reporter.report(e.event, attempts, resp, err)
+		}
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&t.unbatched, 0, 1) {
+		Logger.Printf("Batch of %d audit events was rejected, publishing audit events individually from now on: %v", len(batch), err)
+	}
+	for _, e := range batch {
+		t.sendOne(e)
+	}
+}
+
+func (t *HTTPTransport) sendOne(e encodedEvent) {
+	attempts, resp, err := postWithRetry(t.ctx, t.config, e.body, e.event.DotCased.ID)
+	if errors.Is(err, ErrCircuitOpen) && t.fallbackTransport != nil {
+		t.fallback(e.event, attempts)
+		return
+	}
+
+	if err != nil {
+		Logger.Printf("There was an issue with publishing audit event after %d attempts: %v", attempts, err)
+	}
+
+	t.reporter.report(e.event, attempts, resp, err)
+}
+
+// fallback publishes the audit event with the fallback transport while the
+// circuit breaker is open.
+func (t *HTTPTransport) fallback(event *AuditEventPayload, attempts int) {
+	err := t.fallbackTransport.PublishContext(t.ctx, event)
+	if err == nil {
+		reportHandOff(t.reporter, t.fallbackTransport, event, attempts)
+		return
+	}
+
+	Logger.Printf("There was an issue with publishing audit event with the fallback transport: %v", err)
+	if errors.Is(err, ErrClosed) {
+		t.reporter.report(event, attempts, nil, err)
 	}
 }
 
@@ -168,6 +666,12 @@ type HTTPSyncTransport struct {
 	client    *http.Client
 	transport *http.Transport
 	timeout   time.Duration
+
+	config   publishConfig
+	reporter reporter
+	closed   int32
+
+	fallbackTransport Transporter
 }
 
 // NewHTTPSyncTransport returns a transport that publishes audit events
@@ -199,21 +703,89 @@ func (t *HTTPSyncTransport) Configure(options PublisherOptions) {
 			Timeout:   t.timeout,
 		}
 	}
+
+	t.config = newPublishConfig(t.client, options)
+	t.reporter = newReporter(options)
+
+	t.fallbackTransport = options.FallbackTransport
+	if t.fallbackTransport != nil {
+		t.fallbackTransport.Configure(childOptions(options))
+	}
 }
 
-// Flush is unused.
-func (t *HTTPSyncTransport) Flush(_ time.Duration) bool {
+// ReportsDelivery returns true. Audit events accepted by a fallback transport
+// that does not report delivery are reported as delivered by the transport.
+func (t *HTTPSyncTransport) ReportsDelivery() bool {
 	return true
 }
 
+// Flush waits for audit events published with the fallback transport, if
+// any.
+func (t *HTTPSyncTransport) Flush(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return t.FlushContext(ctx)
+}
+
+// FlushContext waits for audit events published with the fallback transport,
+// if any, or until the context is done.
+func (t *HTTPSyncTransport) FlushContext(ctx context.Context) bool {
+	if t.fallbackTransport != nil {
+		return t.fallbackTransport.FlushContext(ctx)
+	}
+
+	return true
+}
+
+// Close stops accepting audit events. Audit events being published when Close
+// is called are not interrupted.
+func (t *HTTPSyncTransport) Close(ctx context.Context) error {
+	atomic.StoreInt32(&t.closed, 1)
+
+	if t.fallbackTransport != nil {
+		return t.fallbackTransport.Close(ctx)
+	}
+
+	return nil
+}
+
 // Publish publishes the provided audit event to Cased.
 func (t *HTTPSyncTransport) Publish(event *AuditEventPayload) error {
-	_, err := publish(t.client, event)
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext publishes the provided audit event to Cased, aborting the
+// request and any retries once the context is done.
+func (t *HTTPSyncTransport) PublishContext(ctx context.Context, event *AuditEventPayload) error {
+	if atomic.LoadInt32(&t.closed) == 1 {
+		return ErrClosed
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.reporter.report(event, 0, nil, err)
+		return err
+	}
+
+	attempts, resp, err := postWithRetry(ctx, t.config, body, event.DotCased.ID)
+	if errors.Is(err, ErrCircuitOpen) && t.fallbackTransport != nil {
+		err = t.fallbackTransport.PublishContext(ctx, event)
+		if err == nil {
+			reportHandOff(t.reporter, t.fallbackTransport, event, attempts)
+		}
+		return err
+	}
+
+	t.reporter.report(event, attempts, resp, err)
+
 	return err
 }
 
 // NoopHTTPTransport does not publish audit events to Cased.
-type NoopHTTPTransport struct{}
+type NoopHTTPTransport struct {
+	reporter reporter
+}
 
 // NewNoopHTTPTransport returns a client that does not publish audit events to
 // Cased.
@@ -223,10 +795,22 @@ func NewNoopHTTPTransport() *NoopHTTPTransport {
 
 // Configure is a noop operation.
 func (t *NoopHTTPTransport) Configure(options PublisherOptions) {
+	t.reporter = newReporter(options)
+}
+
+func (t *NoopHTTPTransport) ReportsDelivery() bool {
+	return true
 }
 
 // Publish is a noop operation.
 func (t *NoopHTTPTransport) Publish(event *AuditEventPayload) error {
+	return t.PublishContext(context.Background(), event)
+}
+
+// PublishContext is a noop operation. The audit event is reported as delivered
+// without any attempts.
+func (t *NoopHTTPTransport) PublishContext(_ context.Context, event *AuditEventPayload) error {
+	t.reporter.report(event, 0, nil, nil)
 	return nil
 }
 
@@ -235,14 +819,111 @@ func (t *NoopHTTPTransport) Flush(_ time.Duration) bool {
 	return true
 }
 
-func publish(client *http.Client, event *AuditEventPayload) (*http.Response, error) {
-	p := CurrentPublisher()
-	body, err := json.Marshal(event)
-	if err != nil {
-		return nil, err
+// FlushContext is a noop operation.
+func (t *NoopHTTPTransport) FlushContext(_ context.Context) bool {
+	return true
+}
+
+// Close is a noop operation.
+func (t *NoopHTTPTransport) Close(_ context.Context) error {
+	return nil
+}
+
+// encodeBatch joins the JSON encoded audit events into a JSON array.
+func encodeBatch(bodies [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	buf.Write(bytes.Join(bodies, []byte{','}))
+	buf.WriteByte(']')
+
+	return buf.Bytes()
+}
+
+// batchRejected reports whether the response status indicates the publish
+// endpoint does not accept multiple audit events in a single request.
+func batchRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest,
+		http.StatusNotFound,
+		http.StatusMethodNotAllowed,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnsupportedMediaType,
+		http.StatusUnprocessableEntity:
+		return true
+	default:
+		return false
 	}
+}
+
+// childOptions returns the options a transport configures its overflow and
+// fallback transports with, without any overflow or fallback transports of
+// their own.
+func childOptions(options PublisherOptions) PublisherOptions {
+	options.OverflowTransport = nil
+	options.FallbackTransport = nil
+
+	return options
+}
+
+// reportHandOff reports the audit event as delivered once it is accepted by a
+// child transport that does not report the outcome of the audit events it
+// accepts.
+func reportHandOff(r reporter, child Transporter, event *AuditEventPayload, attempts int) {
+	if !reportsDelivery(child) {
+		r.report(event, attempts, nil, nil)
+	}
+}
+
+// publishConfig is the configuration used to publish audit events to Cased,
+// resolved from the PublisherOptions a transport was configured with.
+type publishConfig struct {
+	client      *http.Client
+	url         string
+	key         string
+	retryPolicy RetryPolicy
+	metrics     Metrics
+
+	codec                Codec
+	compressionThreshold int
+
+	breaker *circuitBreaker
+	limiter *RateLimiter
+}
 
-	req, err := http.NewRequest(http.MethodPost, p.Options().PublishURL, bytes.NewReader(body))
+func newPublishConfig(client *http.Client, options PublisherOptions) publishConfig {
+	config := publishConfig{
+		client:      client,
+		url:         options.PublishURL,
+		key:         options.PublishKey,
+		retryPolicy: retryPolicy(options),
+		metrics:     metrics(options),
+
+		codec:                codec(options.Compression),
+		compressionThreshold: options.CompressionThreshold,
+	}
+	config.breaker = newCircuitBreaker(options, config.metrics)
+	config.limiter = newRateLimiter(options)
+
+	if config.url == "" {
+		if PublishURL == "" {
+			config.url = publishURL
+		} else {
+			config.url = PublishURL
+		}
+	}
+
+	return config
+}
+
+// post publishes the JSON encoded body to Cased. The response body is closed
+// before post returns. The body is sent with the provided Content-Encoding if
+// it has been compressed.
+//
+// The idempotency key, if provided, is the ID of the audit event being
+// published. Batches of audit events are deduplicated by the ID of each audit
+// event within the batch instead.
+func post(ctx context.Context, config publishConfig, body []byte, encoding, idempotencyKey string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -251,21 +932,41 @@ func publish(client *http.Client, event *AuditEventPayload) (*http.Response, err
 	req.Header.Set("User-Agent", "cased-go/v0.1")
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Options().PublishKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.key))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	if err := config.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
 
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := config.client.Do(req)
 	if err != nil {
+		config.metrics.ObserveRequest(0, time.Since(start))
 		Logger.Print("Could not publish event")
-		return nil, err
+		return nil, &PublishError{Err: err}
 	}
 
+	// Drain the body so the underlying connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	config.metrics.ObserveRequest(resp.StatusCode, time.Since(start))
+	config.limiter.Observe(resp)
+
 	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return resp, errors.New("unauthorized")
 	case http.StatusOK, http.StatusCreated:
 		Logger.Println("Successfully published audit event.")
 		return resp, nil
 	default:
-		return resp, fmt.Errorf("Received %s while publishing audit event", resp.Status)
+		return resp, &PublishError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 }
@@ -0,0 +1,590 @@
+package cased
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type publishServer struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	requests       int
+	events         []AuditEvent
+	authorizations []string
+	idempotency    []string
+	encodings      []string
+
+	// rejectBatches responds with 422 when more than one audit event is
+	// published in a single request.
+	rejectBatches bool
+
+	// failures is the number of requests to respond to with failStatus before
+	// accepting audit events.
+	failures   int
+	failStatus int
+
+	// gate blocks requests until it is closed.
+	gate    chan struct{}
+	blocked int32
+
+	// delay is how long each request takes to respond.
+	delay       time.Duration
+	inflight    int32
+	maxInflight int32
+}
+
+func newPublishServer(t *testing.T) *publishServer {
+	ps := &publishServer{}
+	ps.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var r io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(req.Body)
+			assert.NoError(t, err)
+			r = gr
+		}
+		body, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+
+		if ps.gate != nil {
+			atomic.AddInt32(&ps.blocked, 1)
+			<-ps.gate
+		}
+
+		if ps.delay > 0 {
+			inflight := atomic.AddInt32(&ps.inflight, 1)
+			defer atomic.AddInt32(&ps.inflight, -1)
+			for {
+				max := atomic.LoadInt32(&ps.maxInflight)
+				if inflight <= max || atomic.CompareAndSwapInt32(&ps.maxInflight, max, inflight) {
+					break
+				}
+			}
+			time.Sleep(ps.delay)
+		}
+
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		ps.requests++
+		ps.authorizations = append(ps.authorizations, req.Header.Get("Authorization"))
+		ps.idempotency = append(ps.idempotency, req.Header.Get("Idempotency-Key"))
+		ps.encodings = append(ps.encodings, req.Header.Get("Content-Encoding"))
+
+		if ps.failures > 0 {
+			ps.failures--
+			w.WriteHeader(ps.failStatus)
+			return
+		}
+
+		var payloads []AuditEventPayload
+		if body[0] == '[' {
+			if ps.rejectBatches {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			assert.NoError(t, json.Unmarshal(body, &payloads))
+		} else {
+			var payload AuditEventPayload
+			assert.NoError(t, json.Unmarshal(body, &payload))
+			payloads = append(payloads, payload)
+		}
+
+		for _, p := range payloads {
+			ps.events = append(ps.events, p.AuditEvent)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	return ps
+}
+
+func (ps *publishServer) counts() (int, int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.requests, len(ps.events)
+}
+
+func (ps *publishServer) actions() []interface{} {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	actions := []interface{}{}
+	for _, e := range ps.events {
+		actions = append(actions, e["action"])
+	}
+	return actions
+}
+
+// fillBuffer publishes audit events until the first audit event is blocked in
+// flight and the buffer of size 1 is full.
+func fillBuffer(t *testing.T, ps *publishServer, p Publisher) {
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.first"}))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&ps.blocked) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.second"}))
+}
+
+func newTestPublisher(ps *publishServer, opts ...PublisherOption) (Publisher, func()) {
+	opts = append([]PublisherOption{
+		WithPublishURL(ps.URL),
+		WithPublishKey("publish_test_5dSfh6xZAuL2Esn3Z2XSM6ReMS21"),
+	}, opts...)
+
+	p := NewPublisher(opts...)
+
+	return p, func() {
+		ps.Close()
+	}
+}
+
+func TestHTTPTransportPublishesBatches(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithBatchLinger(time.Second))
+	defer restore()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 10, events)
+}
+
+func TestHTTPTransportRespectsMaxBatchSize(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithMaxBatchSize(3), WithBatchLinger(time.Second))
+	defer restore()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, 10, events)
+}
+
+func TestHTTPTransportRespectsMaxBatchBytes(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithMaxBatchBytes(1), WithBatchLinger(time.Second))
+	defer restore()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 5, requests)
+	assert.Equal(t, 5, events)
+}
+
+func TestHTTPTransportFallsBackWhenBatchRejected(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.rejectBatches = true
+	p, restore := newTestPublisher(ps, WithBatchLinger(time.Second))
+	defer restore()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, 3, events)
+
+	// Once a batch was rejected, audit events are no longer batched.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events = ps.counts()
+	assert.Equal(t, 7, requests)
+	assert.Equal(t, 6, events)
+}
+
+func TestHTTPTransportPublishesAfterLinger(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithBatchLinger(10*time.Millisecond))
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+
+	assert.Eventually(t, func() bool {
+		_, events := ps.counts()
+		return events == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPSyncTransportRetriesServerErrors(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 2
+	ps.failStatus = http.StatusBadGateway
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 1, events)
+}
+
+func TestHTTPSyncTransportStopsRetryingAfterMaxAttempts(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 5
+	ps.failStatus = http.StatusServiceUnavailable
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+	defer restore()
+
+	err := p.Publish(AuditEvent{"action": "user.login"})
+
+	var pe *PublishError
+	if assert.True(t, errors.As(err, &pe)) {
+		assert.Equal(t, http.StatusServiceUnavailable, pe.StatusCode)
+	}
+	requests, _ := ps.counts()
+	assert.Equal(t, 2, requests)
+}
+
+func TestHTTPSyncTransportDoesNotRetryClientErrors(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 1
+	ps.failStatus = http.StatusUnauthorized
+	p, restore := newTestPublisher(ps,
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	defer restore()
+
+	err := p.Publish(AuditEvent{"action": "user.login"})
+
+	assert.EqualError(t, err, "unauthorized")
+	requests, _ := ps.counts()
+	assert.Equal(t, 1, requests)
+}
+
+func TestHTTPTransportRetriesServerErrors(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 1
+	ps.failStatus = http.StatusTooManyRequests
+	p, restore := newTestPublisher(ps,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+	defer restore()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	requests, events := ps.counts()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 3, events)
+}
+
+func newOverflowTestPublisher(t *testing.T, opts ...PublisherOption) (*publishServer, Publisher, func()) {
+	ps := newPublishServer(t)
+	ps.gate = make(chan struct{})
+
+	ht := NewHTTPTransport()
+	ht.BufferSize = 1
+	opts = append([]PublisherOption{WithTransport(ht), WithMaxBatchSize(1)}, opts...)
+	p, restore := newTestPublisher(ps, opts...)
+
+	return ps, p, restore
+}
+
+func TestHTTPTransportOverflowDropNewest(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t, WithOverflowPolicy(OverflowDropNewest))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	err := p.Publish(AuditEvent{"action": "user.third"})
+	close(ps.gate)
+
+	assert.Equal(t, ErrQueueFull, err)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.second"}, ps.actions())
+	assert.Equal(t, uint64(1), p.Options().Transport.(*HTTPTransport).Dropped())
+}
+
+func TestHTTPTransportOverflowDropOldest(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t, WithOverflowPolicy(OverflowDropOldest))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	err := p.Publish(AuditEvent{"action": "user.third"})
+	close(ps.gate)
+
+	assert.NoError(t, err)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.third"}, ps.actions())
+	assert.Equal(t, uint64(1), p.Options().Transport.(*HTTPTransport).Dropped())
+}
+
+func TestHTTPTransportOverflowBlockWithTimeout(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t,
+		WithOverflowPolicy(OverflowBlock),
+		WithOverflowTimeout(10*time.Millisecond),
+	)
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	err := p.Publish(AuditEvent{"action": "user.third"})
+	close(ps.gate)
+
+	assert.Equal(t, ErrQueueFull, err)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.second"}, ps.actions())
+}
+
+func TestHTTPTransportOverflowSpill(t *testing.T) {
+	rt := &recordingTransport{}
+	ps, p, restore := newOverflowTestPublisher(t, WithOverflowTransport(rt))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	err := p.Publish(AuditEvent{"action": "user.third"})
+	close(ps.gate)
+
+	assert.NoError(t, err)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.second"}, ps.actions())
+	assert.Equal(t, []interface{}{"user.third"}, rt.actions())
+}
+
+func TestHTTPTransportPublishContextAbortsWaitingForBuffer(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t, WithOverflowPolicy(OverflowBlock))
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := p.PublishContext(ctx, AuditEvent{"action": "user.third"})
+	close(ps.gate)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.first", "user.second"}, ps.actions())
+}
+
+func TestHTTPTransportFlushContext(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t)
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.False(t, p.FlushContext(ctx))
+	close(ps.gate)
+	assert.True(t, p.FlushContext(context.Background()))
+}
+
+func TestHTTPSyncTransportPublishContextAbortsRequest(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.gate = make(chan struct{})
+	p, restore := newTestPublisher(ps, WithTransport(NewHTTPSyncTransport()))
+	defer restore()
+	defer close(ps.gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := p.PublishContext(ctx, AuditEvent{"action": "user.login"})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+}
+
+func TestPublishersUseTheirOwnConfiguration(t *testing.T) {
+	first := newPublishServer(t)
+	defer first.Close()
+	second := newPublishServer(t)
+	defer second.Close()
+
+	fp := NewPublisher(
+		WithPublishURL(first.URL),
+		WithPublishKey("publish_test_first"),
+		WithTransport(NewHTTPSyncTransport()),
+	)
+	sp := NewPublisher(
+		WithPublishURL(second.URL),
+		WithPublishKey("publish_test_second"),
+	)
+
+	assert.NoError(t, fp.Publish(AuditEvent{"action": "user.first"}))
+	assert.NoError(t, sp.Publish(AuditEvent{"action": "user.second"}))
+	assert.True(t, sp.Flush(5*time.Second))
+
+	assert.Equal(t, []interface{}{"user.first"}, first.actions())
+	assert.Equal(t, []string{"Bearer publish_test_first"}, first.authorizations)
+	assert.Equal(t, []interface{}{"user.second"}, second.actions())
+	assert.Equal(t, []string{"Bearer publish_test_second"}, second.authorizations)
+}
+
+func TestHTTPTransportClosePublishesQueuedEvents(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps, WithBatchLinger(time.Second))
+	defer restore()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+
+	assert.NoError(t, p.Close(context.Background()))
+	assert.Equal(t, ErrClosed, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(time.Second))
+	assert.NoError(t, p.Close(context.Background()))
+
+	_, events := ps.counts()
+	assert.Equal(t, 3, events)
+}
+
+func TestHTTPTransportCloseReportsLostEvents(t *testing.T) {
+	ps, p, restore := newOverflowTestPublisher(t)
+	defer restore()
+
+	fillBuffer(t, ps, p)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := p.Close(ctx)
+	close(ps.gate)
+
+	var lee *LostEventsError
+	if assert.True(t, errors.As(err, &lee), err) {
+		assert.Equal(t, 2, lee.Lost)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	}
+}
+
+func TestHTTPTransportCanBeReconfigured(t *testing.T) {
+	ps := newPublishServer(t)
+	defer ps.Close()
+
+	ht := NewHTTPTransport()
+	NewPublisher(WithTransport(ht))
+	p := NewPublisher(WithTransport(ht), WithPublishURL(ps.URL))
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.True(t, p.Flush(5*time.Second))
+	assert.Equal(t, []interface{}{"user.login"}, ps.actions())
+}
+
+func TestCloseOnSignal(t *testing.T) {
+	ps := newPublishServer(t)
+	p, restore := newTestPublisher(ps)
+	defer restore()
+
+	done := CloseOnSignal(p, 5*time.Second, os.Interrupt)
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+
+	proc, err := os.FindProcess(os.Getpid())
+	assert.NoError(t, err)
+	assert.NoError(t, proc.Signal(os.Interrupt))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("publisher was not closed")
+	}
+
+	assert.Equal(t, ErrClosed, p.Publish(AuditEvent{"action": "user.login"}))
+	assert.Equal(t, []interface{}{"user.login"}, ps.actions())
+}
+
+func TestHTTPTransportPublishesWithConcurrentWorkers(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.delay = 50 * time.Millisecond
+	p, restore := newTestPublisher(ps, WithWorkers(4), WithMaxBatchSize(1))
+	defer restore()
+
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	_, events := ps.counts()
+	assert.Equal(t, 8, events)
+	assert.True(t, atomic.LoadInt32(&ps.maxInflight) > 1)
+}
+
+func TestHTTPTransportPreservesOrderingKey(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.delay = time.Millisecond
+	p, restore := newTestPublisher(ps,
+		WithWorkers(4),
+		WithMaxBatchSize(1),
+		WithOrderingKey(func(aep *AuditEventPayload) string {
+			return aep.AuditEvent["actor"].(string)
+		}),
+	)
+	defer restore()
+
+	for i := 0; i < 20; i++ {
+		actor := []string{"alice", "bob", "carol"}[i%3]
+		assert.NoError(t, p.Publish(AuditEvent{"action": "user.login", "actor": actor, "sequence": i}))
+	}
+	assert.True(t, p.Flush(5*time.Second))
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	assert.Equal(t, 20, len(ps.events))
+	last := map[interface{}]float64{}
+	for _, e := range ps.events {
+		sequence := e["sequence"].(float64)
+		if previous, ok := last[e["actor"]]; ok {
+			assert.True(t, sequence > previous, "%s published out of order", e["actor"])
+		}
+		last[e["actor"]] = sequence
+	}
+}
+
+func TestHTTPSyncTransportSendsIdempotencyKey(t *testing.T) {
+	ps := newPublishServer(t)
+	ps.failures = 1
+	ps.failStatus = http.StatusBadGateway
+	dr := &deliveryReports{}
+	opts := append(dr.options(),
+		WithTransport(NewHTTPSyncTransport()),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}),
+	)
+	p, restore := newTestPublisher(ps, opts...)
+	defer restore()
+
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login"}))
+
+	if assert.Len(t, dr.delivered, 1) {
+		id := dr.delivered[0].Event.DotCased.ID
+		assert.NotEmpty(t, id)
+		assert.Equal(t, []string{id, id}, ps.idempotency)
+	}
+}
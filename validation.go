@@ -0,0 +1,191 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SchemaPolicy determines what happens to audit events that do not match
+// their schema.
+type SchemaPolicy int
+
+const (
+	// SchemaReject rejects the audit event, Publish returns a
+	// *SchemaValidationError and the audit event is not published.
+	SchemaReject SchemaPolicy = iota
+
+	// SchemaTag publishes the audit event with the violations in the
+	// schema_violations field of .cased.
+	SchemaTag
+
+	// SchemaLog publishes the audit event and logs the violations with Logger.
+	SchemaLog
+)
+
+// SchemaValidationError is returned when an audit event rejected by a
+// SchemaValidator is published.
+type SchemaValidationError struct {
+	Action     string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaValidationError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+
+	return fmt.Sprintf("cased: audit event %q does not match its schema: %s", e.Action, strings.Join(violations, "; "))
+}
+
+// SchemaValidator validates audit events against the JSON Schema registered
+// for their action before they are published:
+//
+//	validator := cased.NewSchemaValidator(cased.SchemaReject)
+//	if err := validator.LoadDir("schemas"); err != nil {
+//		log.Fatal(err)
+//	}
+//	p := cased.NewPublisher(
+//		cased.WithProcessors(append([]cased.EventProcessor{validator.Process}, cased.DefaultProcessors()...)...),
+//	)
+//
+// Audit events whose action has no registered schema are published unless
+// RequireSchema is set.
+type SchemaValidator struct {
+	// Policy determines what happens to audit events that do not match their
+	// schema.
+	Policy SchemaPolicy
+
+	// RequireSchema treats audit events whose action has no registered schema
+	// as violations, catching misspelled actions.
+	RequireSchema bool
+
+	mu      sync.RWMutex
+	schemas map[string]*jsonSchema
+}
+
+// NewSchemaValidator returns a SchemaValidator with no schemas registered.
+func NewSchemaValidator(policy SchemaPolicy) *SchemaValidator {
+	return &SchemaValidator{
+		Policy:  policy,
+		schemas: map[string]*jsonSchema{},
+	}
+}
+
+// Register registers the JSON Schema for audit events with the action,
+// replacing any schema previously registered for it. Schemas embedded in the
+// application can be registered directly.
+func (v *SchemaValidator) Register(action string, schema []byte) error {
+	s, err := compileSchema(schema)
+	if err != nil {
+		return fmt.Errorf("cased: invalid schema for %q: %w", action, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.schemas == nil {
+		v.schemas = map[string]*jsonSchema{}
+	}
+	v.schemas[action] = s
+
+	return nil
+}
+
+// RegisterFile registers the JSON Schema in the file for audit events with the
+// action.
+func (v *SchemaValidator) RegisterFile(action, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return v.Register(action, data)
+}
+
+// LoadDir registers each .json file in the directory as the schema for the
+// action it is named after, such as user.login.json for user.login.
+func (v *SchemaValidator) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		action := strings.TrimSuffix(filepath.Base(path), ".json")
+		if err := v.RegisterFile(action, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate returns the violations of the audit event against the schema
+// registered for its action.
+func (v *SchemaValidator) Validate(event AuditEvent) ([]SchemaViolation, error) {
+	action, _ := event[ActionField].(string)
+
+	v.mu.RLock()
+	s, ok := v.schemas[action]
+	v.mu.RUnlock()
+
+	if !ok {
+		if v.RequireSchema {
+			return []SchemaViolation{{Message: fmt.Sprintf("no schema is registered for action %q", action)}}, nil
+		}
+		return nil, nil
+	}
+
+	// Validate the audit event as it is published, with sensitive values,
+	// times and other types encoded as JSON.
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return s.validate("", doc), nil
+}
+
+// Process validates the audit event and handles violations according to the
+// policy, returning a *SchemaValidationError if the audit event is rejected.
+// It is an EventProcessor configured with WithProcessors, and should run before
+// processors that record the final audit event, such as HashChain.Process.
+func (v *SchemaValidator) Process(ctx context.Context, aep *AuditEventPayload) error {
+	violations, err := v.Validate(aep.AuditEvent)
+	if err != nil {
+		Logger.Printf("Unable to validate audit event: %v", err)
+		return nil
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	action, _ := aep.AuditEvent[ActionField].(string)
+
+	switch v.Policy {
+	case SchemaReject:
+		return &SchemaValidationError{Action: action, Violations: violations}
+	case SchemaTag:
+		aep.DotCased.SchemaViolations = violations
+	case SchemaLog:
+		Logger.Println((&SchemaValidationError{Action: action, Violations: violations}).Error())
+	}
+
+	return nil
+}
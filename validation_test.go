@@ -0,0 +1,193 @@
+package cased
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const loginSchema = `{
+	"type": "object",
+	"required": ["action", "actor", "location"],
+	"additionalProperties": false,
+	"properties": {
+		"action": {"const": "user.login"},
+		"actor": {"type": "string", "format": "email"},
+		"location": {"$ref": "#/definitions/ip"},
+		"method": {"enum": ["password", "sso"]},
+		"attempts": {"type": "integer", "minimum": 1},
+		"created_at": {"type": "string", "format": "date-time"},
+		"roles": {"type": "array", "items": {"type": "string", "minLength": 1}, "uniqueItems": true}
+	},
+	"definitions": {
+		"ip": {"anyOf": [{"format": "ipv4"}, {"format": "ipv6"}], "type": "string"}
+	}
+}`
+
+func newTestSchemaValidator(t *testing.T, policy SchemaPolicy) *SchemaValidator {
+	v := NewSchemaValidator(policy)
+	assert.NoError(t, v.Register("user.login", []byte(loginSchema)))
+
+	return v
+}
+
+func newSchemaTestPublisher(t *testing.T, policy SchemaPolicy, transport Transporter) Publisher {
+	validator := newTestSchemaValidator(t, policy)
+
+	return NewPublisher(
+		WithTransport(transport),
+		WithProcessors(append([]EventProcessor{validator.Process}, DefaultProcessors()...)...),
+	)
+}
+
+func TestSchemaValidatorValidate(t *testing.T) {
+	v := newTestSchemaValidator(t, SchemaReject)
+
+	violations, err := v.Validate(AuditEvent{
+		"action":     "user.login",
+		"actor":      NewSensitiveValue("user@example.com", EmailSensitiveLabel),
+		"location":   "2001:db8::1",
+		"method":     "sso",
+		"attempts":   2,
+		"created_at": time.Now(),
+		"roles":      []string{"admin", "member"},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	violations, err = v.Validate(AuditEvent{
+		"action":   "user.login",
+		"actor":    "user",
+		"method":   "pasword",
+		"attempts": 1.5,
+		"roles":    []string{"admin", "admin", ""},
+		"usr":      "typo",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{
+		{Path: ".location", Message: "is required"},
+		{Path: ".actor", Message: "must be a valid email"},
+		{Path: ".attempts", Message: "expected integer, got number"},
+		{Path: ".method", Message: `must be one of "password", "sso"`},
+		{Path: ".roles", Message: "items must be unique"},
+		{Path: ".roles[2]", Message: "must be at least 1 characters"},
+		{Path: ".usr", Message: "is not allowed"},
+	}, violations)
+}
+
+func TestSchemaValidatorUnregisteredActions(t *testing.T) {
+	v := newTestSchemaValidator(t, SchemaReject)
+
+	violations, err := v.Validate(AuditEvent{"action": "user.logout"})
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	v.RequireSchema = true
+	violations, err = v.Validate(AuditEvent{"action": "user.lgoin"})
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{{Message: `no schema is registered for action "user.lgoin"`}}, violations)
+}
+
+func TestSchemaValidatorRegisterInvalidSchema(t *testing.T) {
+	v := NewSchemaValidator(SchemaReject)
+
+	assert.Error(t, v.Register("user.login", []byte(`{"type":`)))
+	assert.Error(t, v.Register("user.login", []byte(`{"pattern": "("}`)))
+	assert.Error(t, v.Register("user.login", []byte(`{"$ref": "#/definitions/missing"}`)))
+	assert.Error(t, v.Register("user.login", []byte(`{"$ref": "https://example.com/schema.json"}`)))
+}
+
+func TestSchemaValidatorRecursiveReference(t *testing.T) {
+	v := NewSchemaValidator(SchemaReject)
+	assert.NoError(t, v.Register("org.create", []byte(`{
+		"properties": {"org": {"$ref": "#/definitions/org"}},
+		"definitions": {
+			"org": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"parent": {"$ref": "#/definitions/org"}}
+			}
+		}
+	}`)))
+
+	violations, err := v.Validate(AuditEvent{
+		"action": "org.create",
+		"org":    map[string]interface{}{"name": "a", "parent": map[string]interface{}{"parent": nil}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{
+		{Path: ".org.parent.name", Message: "is required"},
+		{Path: ".org.parent.parent", Message: "expected object, got null"},
+	}, violations)
+}
+
+func TestSchemaValidatorLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cased-schemas")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "user.login.json"), []byte(loginSchema), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Schemas"), 0600))
+
+	v := NewSchemaValidator(SchemaReject)
+	assert.NoError(t, v.LoadDir(dir))
+
+	violations, err := v.Validate(AuditEvent{"action": "user.login"})
+	assert.NoError(t, err)
+	assert.Len(t, violations, 2)
+}
+
+func TestSchemaRejectReturnsErrorFromPublish(t *testing.T) {
+	transport := &recordingTransport{}
+	p := newSchemaTestPublisher(t, SchemaReject, transport)
+	previous := CurrentPublisher()
+	SetPublisher(p)
+	defer SetPublisher(previous)
+
+	err := Publish(AuditEvent{"action": "user.login", "actor": "user@example.com"})
+
+	var sve *SchemaValidationError
+	if assert.True(t, errors.As(err, &sve)) {
+		assert.Equal(t, "user.login", sve.Action)
+		assert.Equal(t, []SchemaViolation{{Path: ".location", Message: "is required"}}, sve.Violations)
+	}
+
+	result := p.(*Client).PublishAsync(context.Background(), AuditEvent{"action": "user.login"})
+	assert.True(t, errors.As(result.Wait(context.Background()), &sve))
+
+	assert.NoError(t, Publish(AuditEvent{"action": "user.login", "actor": "user@example.com", "location": "1.1.1.1"}))
+	assert.Equal(t, []interface{}{"user.login"}, transport.actions())
+}
+
+func TestSchemaTagPublishesViolations(t *testing.T) {
+	transport := &recordingTransport{}
+	p := newSchemaTestPublisher(t, SchemaTag, transport)
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login", "actor": "user@example.com"}))
+
+	if assert.Len(t, transport.events, 1) {
+		assert.Equal(t, []SchemaViolation{{Path: ".location", Message: "is required"}}, transport.events[0].DotCased.SchemaViolations)
+	}
+}
+
+func TestSchemaLogPublishesAndLogsViolations(t *testing.T) {
+	var buf bytes.Buffer
+	logger := Logger
+	Logger = log.New(&buf, "", 0)
+	defer func() { Logger = logger }()
+
+	transport := &recordingTransport{}
+	p := newSchemaTestPublisher(t, SchemaLog, transport)
+	assert.NoError(t, p.Publish(AuditEvent{"action": "user.login", "actor": "user@example.com"}))
+
+	assert.Len(t, transport.events, 1)
+	assert.Empty(t, transport.events[0].DotCased.SchemaViolations)
+	assert.Contains(t, buf.String(), `audit event "user.login" does not match its schema: .location: is required`)
+}